@@ -1,24 +1,36 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"sync"
 	"syscall"
+	"time"
 
+	"gbbs/internal/chat"
 	"gbbs/internal/config"
 	"gbbs/internal/irc"
+	"gbbs/internal/mail"
+	"gbbs/internal/menu"
 	"gbbs/internal/messageboard"
+	"gbbs/internal/node"
+	"gbbs/internal/session"
 	"gbbs/internal/ssh"
 	"gbbs/internal/telnet"
 	"gbbs/internal/user"
 	"gbbs/internal/web"
 )
 
-var debug = flag.Bool("debug", false, "Enable debug mode")
+var (
+	debug   = flag.Bool("debug", false, "Enable debug mode")
+	setRole = flag.String("set-role", "", "Set a user's role (username:role) and exit")
+)
 
 func main() {
 	flag.Parse()
@@ -49,50 +61,94 @@ func main() {
 
 	log.Printf("Loaded configuration: %+v", cfg)
 
-	userManager, err := user.NewManager("bbs.db")
+	const dbPath = "bbs.db"
+
+	userManager, err := user.NewManager(dbPath)
 	if err != nil {
 		log.Fatalf("Failed to initialize user manager: %v", err)
 	}
 	defer userManager.Close()
 
-	messageBoard, err := messageboard.New(cfg.GuestbookPath)
+	if *setRole != "" {
+		parts := strings.SplitN(*setRole, ":", 2)
+		if len(parts) != 2 {
+			fmt.Fprintln(os.Stderr, "usage: -set-role username:role")
+			os.Exit(2)
+		}
+		if err := userManager.SetRole(parts[0], parts[1]); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to set role: %v (roles: %s)\n", err, strings.Join(user.Roles, ", "))
+			os.Exit(1)
+		}
+		fmt.Printf("%s is now %s\n", parts[0], parts[1])
+		return
+	}
+
+	boards, err := messageboard.NewManager(dbPath, cfg.Boards, cfg.BoardsDir)
+	if err != nil {
+		log.Fatalf("Failed to initialize message boards: %v", err)
+	}
+	defer boards.Close()
+
+	mailManager, err := mail.NewManager(dbPath, userManager)
 	if err != nil {
-		log.Fatalf("Failed to initialize message board: %v", err)
+		log.Fatalf("Failed to initialize mail: %v", err)
+	}
+	defer mailManager.Close()
+
+	menus, err := menu.Load(cfg.MenuPath)
+	if os.IsNotExist(err) {
+		log.Printf("Menu file %s not found, using built-in menus", cfg.MenuPath)
+		menus, err = menu.Default(), nil
+	}
+	if err == nil {
+		err = session.CheckMenus(menus)
+	}
+	if err != nil {
+		log.Fatalf("Failed to load menus: %v", err)
 	}
 
 	var ircBridge *irc.Bridge
 	if cfg.IRCBridge.Enabled {
 		ircBridge = irc.NewBridge(cfg.IRCBridge)
-		err := ircBridge.Connect()
-		if err != nil {
-			log.Printf("Failed to connect to IRC: %v", err)
-		} else {
-			log.Printf("Connected to IRC server %s", cfg.IRCBridge.Server)
-		}
+		ircBridge.Start()
+		log.Printf("Connecting to IRC server %s", cfg.IRCBridge.Server)
+	}
+
+	services := &session.Services{
+		Config:     cfg,
+		Users:      userManager,
+		Boards:     boards,
+		Mail:       mailManager,
+		IRCBridge:  ircBridge,
+		Menus:      menus,
+		Nodes:      node.NewRegistry(),
+		Chat:       chat.NewRoom(),
+		SysopPages: chat.NewSysopPages(),
 	}
 
 	// Set up graceful shutdown
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
 
+	ctx, stopServers := context.WithCancel(context.Background())
 	var wg sync.WaitGroup
 
 	wg.Add(3)
 	go func() {
 		defer wg.Done()
-		if err := telnet.Serve(cfg, userManager, messageBoard, ircBridge); err != nil {
+		if err := telnet.Serve(ctx, services); err != nil {
 			log.Printf("Telnet server error: %v", err)
 		}
 	}()
 	go func() {
 		defer wg.Done()
-		if err := ssh.Serve(cfg, userManager, messageBoard, ircBridge); err != nil {
+		if err := ssh.Serve(ctx, services); err != nil {
 			log.Printf("SSH server error: %v", err)
 		}
 	}()
 	go func() {
 		defer wg.Done()
-		if err := web.Serve(cfg.WebPort, cfg.WebRoot, userManager, messageBoard); err != nil {
+		if err := web.Serve(ctx, services); err != nil {
 			log.Printf("Web server error: %v", err)
 		}
 	}()
@@ -103,13 +159,53 @@ func main() {
 	<-shutdown
 	log.Println("Shutting down...")
 
+	// A second signal skips the grace period
+	go func() {
+		<-shutdown
+		log.Println("Forcing shutdown")
+		services.Nodes.DisconnectAll()
+	}()
+
+	stopServers()
+	drainNodes(services.Nodes, time.Duration(cfg.ShutdownGracePeriod)*time.Second)
+	wg.Wait()
+
 	// Close IRC bridge
 	if ircBridge != nil {
 		ircBridge.Close()
 	}
 
-	// TODO: Add code to gracefully shut down telnet, ssh, and web servers
-
-	wg.Wait()
 	log.Println("Shutdown complete")
 }
+
+// drainNodes warns everyone online that the BBS is going down and gives
+// telnet and SSH callers until the grace period ends to log off before
+// dropping whoever is left. Web nodes are only sessions, so they do not
+// hold up the shutdown.
+func drainNodes(nodes *node.Registry, grace time.Duration) {
+	if len(nodes.List()) == 0 {
+		return
+	}
+
+	nodes.Broadcast(node.Message{
+		Kind: node.KindShutdown,
+		Text: fmt.Sprintf("The BBS is shutting down in %d seconds. Please finish up and log off.", int(grace.Seconds())),
+		Time: time.Now(),
+	})
+
+	deadline := time.Now().Add(grace)
+	for time.Now().Before(deadline) && callersOnline(nodes) > 0 {
+		time.Sleep(250 * time.Millisecond)
+	}
+	nodes.DisconnectAll()
+}
+
+func callersOnline(nodes *node.Registry) int {
+	count := 0
+	for _, info := range nodes.List() {
+		if info.Protocol != "web" {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,113 @@
+package chat
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"gbbs/internal/node"
+)
+
+// historySize is how many lines of scrollback the room keeps for people
+// joining later.
+const historySize = 50
+
+// Line is one entry in the room's scrollback. IDs increase so clients can
+// poll for lines newer than the last one they saw.
+type Line struct {
+	ID int64 `json:"id"`
+	node.Message
+}
+
+// Room is the teleconference: every node in it receives what the others
+// say.
+type Room struct {
+	mu      sync.Mutex
+	members map[*node.Node]bool
+	history []Line
+	nextID  int64
+}
+
+func NewRoom() *Room {
+	return &Room{members: make(map[*node.Node]bool), nextID: 1}
+}
+
+// Join adds a node to the room and announces it.
+func (r *Room) Join(n *node.Node) {
+	r.mu.Lock()
+	r.members[n] = true
+	r.mu.Unlock()
+	r.broadcast(node.Message{Kind: node.KindSystem, Text: n.Username() + " has joined"}, n)
+}
+
+// Leave removes a node from the room and announces it.
+func (r *Room) Leave(n *node.Node) {
+	r.mu.Lock()
+	delete(r.members, n)
+	r.mu.Unlock()
+	r.broadcast(node.Message{Kind: node.KindSystem, Text: n.Username() + " has left"}, nil)
+}
+
+// Say sends a line to everyone in the room except the node it came from,
+// which has already shown it. from may be nil for lines posted from the
+// web.
+func (r *Room) Say(from *node.Node, username, text string) Line {
+	return r.broadcast(node.Message{Kind: node.KindChat, From: username, Text: text}, from)
+}
+
+// Emote sends an action ("/me waves") to everyone in the room, including
+// the node it came from.
+func (r *Room) Emote(username, action string) Line {
+	return r.broadcast(node.Message{Kind: node.KindSystem, Text: username + " " + action}, nil)
+}
+
+func (r *Room) broadcast(msg node.Message, skip *node.Node) Line {
+	msg.Time = time.Now()
+
+	r.mu.Lock()
+	line := Line{ID: r.nextID, Message: msg}
+	r.nextID++
+	r.history = append(r.history, line)
+	if len(r.history) > historySize {
+		r.history = r.history[len(r.history)-historySize:]
+	}
+	members := make([]*node.Node, 0, len(r.members))
+	for n := range r.members {
+		if n != skip {
+			members = append(members, n)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, n := range members {
+		n.Deliver(msg)
+	}
+	return line
+}
+
+// Members returns the usernames in the room, sorted.
+func (r *Room) Members() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.members))
+	for n := range r.members {
+		names = append(names, n.Username())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// History returns the scrollback lines with IDs greater than since.
+func (r *Room) History(since int64) []Line {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var lines []Line
+	for _, line := range r.history {
+		if line.ID > since {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
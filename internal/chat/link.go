@@ -0,0 +1,51 @@
+package chat
+
+import "sync"
+
+// linkBuffer is how many keystrokes can be in flight to a slow peer before
+// Send blocks.
+const linkBuffer = 256
+
+// End is one side of a private keystroke-by-keystroke connection between
+// two nodes, used for sysop chat. Closing either end closes both.
+type End struct {
+	send chan<- rune
+	recv <-chan rune
+	done chan struct{}
+	once *sync.Once
+}
+
+// NewLink returns the two connected ends of a link.
+func NewLink() (*End, *End) {
+	ab := make(chan rune, linkBuffer)
+	ba := make(chan rune, linkBuffer)
+	done := make(chan struct{})
+	once := &sync.Once{}
+	return &End{send: ab, recv: ba, done: done, once: once},
+		&End{send: ba, recv: ab, done: done, once: once}
+}
+
+// Send passes a keystroke to the other end. It reports false once the link
+// is closed.
+func (e *End) Send(r rune) bool {
+	select {
+	case e.send <- r:
+		return true
+	case <-e.done:
+		return false
+	}
+}
+
+// Recv returns the channel keystrokes from the other end arrive on.
+func (e *End) Recv() <-chan rune {
+	return e.recv
+}
+
+// Done is closed when either end closes the link.
+func (e *End) Done() <-chan struct{} {
+	return e.done
+}
+
+func (e *End) Close() {
+	e.once.Do(func() { close(e.done) })
+}
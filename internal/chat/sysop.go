@@ -0,0 +1,96 @@
+package chat
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"gbbs/internal/node"
+)
+
+var ErrNoSuchPage = errors.New("that caller is no longer waiting")
+
+// PageRequest is a caller waiting for a sysop to answer their page.
+type PageRequest struct {
+	Caller string
+	Node   int
+	Reason string
+	Time   time.Time
+
+	answer chan *End
+}
+
+// Answered delivers the caller's end of the chat link once a sysop
+// accepts.
+func (r *PageRequest) Answered() <-chan *End {
+	return r.answer
+}
+
+// SysopPages tracks callers paging the sysop, keyed by node number.
+type SysopPages struct {
+	mu      sync.Mutex
+	pending map[int]*PageRequest
+}
+
+func NewSysopPages() *SysopPages {
+	return &SysopPages{pending: make(map[int]*PageRequest)}
+}
+
+// Request records that the caller on n is paging the sysop, replacing any
+// earlier page from that node.
+func (p *SysopPages) Request(n *node.Node, reason string) *PageRequest {
+	req := &PageRequest{
+		Caller: n.Username(),
+		Node:   n.Number,
+		Reason: reason,
+		Time:   time.Now(),
+		answer: make(chan *End, 1),
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending[n.Number] = req
+	return req
+}
+
+// Cancel withdraws a page. It reports false if a sysop already accepted it,
+// in which case the link is waiting on Answered.
+func (p *SysopPages) Cancel(req *PageRequest) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pending[req.Node] != req {
+		return false
+	}
+	delete(p.pending, req.Node)
+	return true
+}
+
+// Pending lists the callers waiting, oldest first.
+func (p *SysopPages) Pending() []PageRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	list := make([]PageRequest, 0, len(p.pending))
+	for _, req := range p.pending {
+		list = append(list, *req)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Time.Before(list[j].Time) })
+	return list
+}
+
+// Accept answers the page from a node and returns the sysop's end of the
+// chat link; the caller gets the other end.
+func (p *SysopPages) Accept(number int) (*End, *PageRequest, error) {
+	p.mu.Lock()
+	req, ok := p.pending[number]
+	delete(p.pending, number)
+	p.mu.Unlock()
+	if !ok {
+		return nil, nil, ErrNoSuchPage
+	}
+
+	sysop, caller := NewLink()
+	req.answer <- caller
+	return sysop, req, nil
+}
@@ -4,19 +4,34 @@ import (
 	"encoding/json"
 	"fmt"
 	"gbbs/internal/irc"
+	"gbbs/internal/messageboard"
 	"log"
 	"os"
 	"path/filepath"
 )
 
 type Config struct {
-	TelnetPort        int              `json:"telnet_port"`
-	SSHPort           int              `json:"ssh_port"`
-	WebPort           int              `json:"web_port"`
-	GuestbookPath     string           `json:"guestbook_path"`
-	WebRoot           string           `json:"web_root"`
-	WelcomeScreenPath string           `json:"welcome_screen_path"`
-	IRCBridge         irc.BridgeConfig `json:"irc_bridge"`
+	TelnetPort        int                        `json:"telnet_port"`
+	SSHPort           int                        `json:"ssh_port"`
+	WebPort           int                        `json:"web_port"`
+	GuestbookPath     string                     `json:"guestbook_path"`
+	BoardsDir         string                     `json:"boards_dir"`
+	Boards            []messageboard.BoardConfig `json:"boards"`
+	WebRoot           string                     `json:"web_root"`
+	WelcomeScreenPath string                     `json:"welcome_screen_path"`
+	MenuPath          string                     `json:"menu_path"`
+	SSHHostKeys       []HostKey                  `json:"ssh_host_keys"`
+	IRCBridge         irc.BridgeConfig           `json:"irc_bridge"`
+	// ShutdownGracePeriod is how many seconds connected callers get to log
+	// off after the shutdown warning before they are disconnected.
+	ShutdownGracePeriod int `json:"shutdown_grace_period"`
+}
+
+// HostKey names an SSH host key file and the key type to generate there if
+// the file does not exist yet. Supported types are ed25519, ecdsa and rsa.
+type HostKey struct {
+	Type string `json:"type"`
+	Path string `json:"path"`
 }
 
 func Load() (*Config, error) {
@@ -25,12 +40,21 @@ func Load() (*Config, error) {
 		SSHPort:           2222,
 		WebPort:           8080,
 		GuestbookPath:     "guestbook.txt",
+		BoardsDir:         "boards",
 		WebRoot:           "web",
 		WelcomeScreenPath: "welcome.ans",
+		MenuPath:          "menus.json",
+		SSHHostKeys: []HostKey{
+			{Type: "ed25519", Path: "ssh_host_ed25519_key"},
+			{Type: "ecdsa", Path: "ssh_host_ecdsa_key"},
+			{Type: "rsa", Path: "ssh_host_rsa_key"},
+		},
 		IRCBridge: irc.BridgeConfig{
-			Enabled: false,
-			Port:    6667,
+			Enabled:        false,
+			Port:           6667,
+			ConnectTimeout: 30,
 		},
+		ShutdownGracePeriod: 30,
 	}
 
 	// Get the executable path
@@ -94,8 +118,39 @@ func Load() (*Config, error) {
 
 	// Convert relative paths to absolute paths
 	cfg.GuestbookPath = makeAbsolute(filepath.Dir(configFile), cfg.GuestbookPath)
+	cfg.BoardsDir = makeAbsolute(filepath.Dir(configFile), cfg.BoardsDir)
+	for i := range cfg.Boards {
+		if cfg.Boards[i].Path != "" {
+			cfg.Boards[i].Path = makeAbsolute(filepath.Dir(configFile), cfg.Boards[i].Path)
+		}
+	}
 	cfg.WebRoot = makeAbsolute(filepath.Dir(configFile), cfg.WebRoot)
 	cfg.WelcomeScreenPath = makeAbsolute(filepath.Dir(configFile), cfg.WelcomeScreenPath)
+	cfg.MenuPath = makeAbsolute(filepath.Dir(configFile), cfg.MenuPath)
+	for i := range cfg.SSHHostKeys {
+		cfg.SSHHostKeys[i].Path = makeAbsolute(filepath.Dir(configFile), cfg.SSHHostKeys[i].Path)
+	}
+	if cfg.IRCBridge.TLSCAFile != "" {
+		cfg.IRCBridge.TLSCAFile = makeAbsolute(filepath.Dir(configFile), cfg.IRCBridge.TLSCAFile)
+	}
+	if cfg.IRCBridge.ClientCert != "" {
+		cfg.IRCBridge.ClientCert = makeAbsolute(filepath.Dir(configFile), cfg.IRCBridge.ClientCert)
+	}
+	if cfg.IRCBridge.ClientKey != "" {
+		cfg.IRCBridge.ClientKey = makeAbsolute(filepath.Dir(configFile), cfg.IRCBridge.ClientKey)
+	}
+	if cfg.IRCBridge.Enabled {
+		if err := cfg.IRCBridge.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid irc_bridge config: %v", err)
+		}
+	}
+
+	// Without any boards configured, the guestbook is the only board
+	if len(cfg.Boards) == 0 {
+		cfg.Boards = []messageboard.BoardConfig{
+			{Name: "general", Description: "General discussion", Path: cfg.GuestbookPath},
+		}
+	}
 
 	return cfg, nil
 }
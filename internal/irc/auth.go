@@ -0,0 +1,176 @@
+package irc
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	ircevent "github.com/thoj/go-ircevent"
+)
+
+// saslFailures are the numerics a server answers a failed SASL exchange
+// with.
+var saslFailures = []string{"902", "904", "905", "906", "908"}
+
+// nickTaken are the numerics refusing the nick we asked for.
+var nickTaken = []string{"432", "433", "437"}
+
+// saslRetryDelay is how long the bridge goes without SASL after the server
+// turns it down, in case the account or the server is fixed meanwhile.
+const saslRetryDelay = 30 * time.Minute
+
+// useSASL reports whether the next connection should authenticate with
+// SASL. For a while after the server has turned it down the bridge does
+// without.
+func (b *Bridge) useSASL() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.Config.SASL.Mechanism != "" && !time.Now().Before(b.saslRetry)
+}
+
+// account is the name the bridge authenticates as.
+func (b *Bridge) account() string {
+	if b.Config.SASL.Username != "" {
+		return b.Config.SASL.Username
+	}
+	return b.Config.Nick
+}
+
+func (b *Bridge) username() string {
+	if b.Config.Username != "" {
+		return b.Config.Username
+	}
+	return b.Config.Nick
+}
+
+func (b *Bridge) realName() string {
+	if b.Config.RealName != "" {
+		return b.Config.RealName
+	}
+	return b.Config.Nick
+}
+
+func (b *Bridge) setupSASL(conn *ircevent.Connection) {
+	conn.UseSASL = true
+	conn.SASLMech = "PLAIN"
+	conn.SASLLogin = b.account()
+	conn.SASLPassword = b.Config.SASL.Password
+	if strings.EqualFold(b.Config.SASL.Mechanism, "external") {
+		useExternal(conn)
+	}
+}
+
+// useExternal makes a connection authenticate with SASL EXTERNAL, which
+// ircevent does not speak itself. ircevent still opens the negotiation and
+// holds registration until the 903 or 904 that ends it, but as soon as the
+// server lists its capabilities its CAP and AUTHENTICATE handling, which
+// would send PLAIN, is swapped for ours. The server knows us by our TLS
+// client certificate, so the response is empty.
+func useExternal(conn *ircevent.Connection) {
+	conn.AddCallback("CAP", func(e *ircevent.Event) {
+		if len(e.Arguments) != 3 || e.Arguments[1] != "LS" {
+			return
+		}
+		conn.ClearCallback("CAP")
+		conn.ClearCallback("AUTHENTICATE")
+		conn.AddCallback("CAP", func(e *ircevent.Event) {
+			if len(e.Arguments) == 3 && e.Arguments[1] == "ACK" && hasCap(e.Arguments[2], "sasl") {
+				conn.SendRaw("AUTHENTICATE EXTERNAL")
+			}
+		})
+		conn.AddCallback("AUTHENTICATE", func(e *ircevent.Event) {
+			if e.Message() == "+" {
+				conn.SendRaw("AUTHENTICATE +")
+			}
+		})
+	})
+}
+
+// watchSASL returns a channel that receives the server's reason if it
+// turns down our SASL authentication, or does not offer it at all.
+func watchSASL(conn *ircevent.Connection) <-chan string {
+	rejected := make(chan string, 1)
+	reject := func(reason string) {
+		select {
+		case rejected <- reason:
+		default:
+		}
+	}
+	for _, code := range saslFailures {
+		conn.AddCallback(code, func(e *ircevent.Event) {
+			reject(e.Message())
+		})
+	}
+	conn.AddCallback("CAP", func(e *ircevent.Event) {
+		if len(e.Arguments) == 3 && e.Arguments[1] == "LS" && !hasCap(e.Arguments[2], "sasl") {
+			reject("the server does not support SASL")
+		}
+	})
+	return rejected
+}
+
+// hasCap reports whether a CAP LS or ACK list names capability, with or
+// without a value.
+func hasCap(list, capability string) bool {
+	for _, name := range strings.Fields(list) {
+		if name == capability || strings.HasPrefix(name, capability+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// fallBackFromSASL makes connections skip SASL for a while, identifying
+// with NickServ instead if a password for it is configured.
+func (b *Bridge) fallBackFromSASL(err error) {
+	b.mu.Lock()
+	b.saslRetry = time.Now().Add(saslRetryDelay)
+	b.mu.Unlock()
+
+	if b.Config.NickServPassword != "" {
+		b.report("SASL authentication failed (%v), identifying with NickServ instead", err)
+	} else {
+		b.report("SASL authentication failed (%v), connecting without it", err)
+	}
+}
+
+// identify logs in to NickServ, for networks or configurations without
+// SASL.
+func (b *Bridge) identify(conn *ircevent.Connection) {
+	if b.Config.NickServPassword == "" {
+		return
+	}
+	conn.Privmsg("NickServ", fmt.Sprintf("IDENTIFY %s %s", b.account(), b.Config.NickServPassword))
+}
+
+// setupNicks replaces ircevent's handling of a taken nick, which only
+// appends underscores, with trying each alternate nick in turn and then
+// numbered variants of the main one.
+func (b *Bridge) setupNicks(conn *ircevent.Connection) {
+	nicks := append([]string{b.Config.Nick}, b.Config.AltNicks...)
+	next := 1
+	registered := false
+
+	conn.AddCallback("001", func(e *ircevent.Event) {
+		registered = true
+	})
+
+	taken := func(e *ircevent.Event) {
+		// Once registered we keep whatever nick we have
+		if registered {
+			return
+		}
+		nick := fmt.Sprintf("%s%d", b.Config.Nick, next-len(nicks)+1)
+		if next < len(nicks) {
+			nick = nicks[next]
+		}
+		next++
+		log.Printf("IRC nick refused (%s), trying %s", e.Message(), nick)
+		conn.Nick(nick)
+	}
+	for _, code := range nickTaken {
+		conn.ClearCallback(code)
+		conn.AddCallback(code, taken)
+	}
+}
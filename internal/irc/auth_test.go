@@ -0,0 +1,403 @@
+package irc
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeServer accepts the bridge's connections and lets a test play the IRC
+// server's side of them line by line.
+type fakeServer struct {
+	ln    net.Listener
+	conns chan net.Conn
+}
+
+type fakeClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return serveFake(t, ln)
+}
+
+// newFakeTLSServer is newFakeServer speaking TLS with the settings in
+// tlsConfig.
+func newFakeTLSServer(t *testing.T, tlsConfig *tls.Config) *fakeServer {
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return serveFake(t, ln)
+}
+
+func serveFake(t *testing.T, ln net.Listener) *fakeServer {
+	srv := &fakeServer{ln: ln, conns: make(chan net.Conn, 4)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				close(srv.conns)
+				return
+			}
+			srv.conns <- conn
+		}
+	}()
+	t.Cleanup(func() {
+		ln.Close()
+		for conn := range srv.conns {
+			conn.Close()
+		}
+	})
+	return srv
+}
+
+func (s *fakeServer) config() BridgeConfig {
+	addr := s.ln.Addr().(*net.TCPAddr)
+	return BridgeConfig{
+		Enabled:  true,
+		Server:   addr.IP.String(),
+		Port:     addr.Port,
+		Nick:     "bbs",
+		Channels: []Channel{{Name: "#bbs"}},
+	}
+}
+
+// accept waits for the bridge's next connection, which after a failed one
+// comes after the reconnect delay.
+func (s *fakeServer) accept(t *testing.T) *fakeClient {
+	t.Helper()
+	select {
+	case conn := <-s.conns:
+		t.Cleanup(func() { conn.Close() })
+		return &fakeClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+	case <-time.After(2*minReconnectDelay + 5*time.Second):
+		t.Fatal("the bridge did not connect")
+		return nil
+	}
+}
+
+func (c *fakeClient) send(line string) {
+	c.t.Helper()
+	if _, err := c.conn.Write([]byte(line + "\r\n")); err != nil {
+		c.t.Fatalf("sending %q: %v", line, err)
+	}
+}
+
+// expect reads lines from the bridge until one starts with prefix and
+// returns it along with the lines skipped on the way.
+func (c *fakeClient) expect(prefix string) (string, []string) {
+	c.t.Helper()
+	var skipped []string
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			c.t.Fatalf("waiting for %q after %q: %v", prefix, skipped, err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if strings.HasPrefix(line, prefix) {
+			return line, skipped
+		}
+		skipped = append(skipped, line)
+	}
+}
+
+// newTestBridge makes a bridge in a scratch directory, since it writes its
+// log under ./logs.
+func newTestBridge(t *testing.T, config BridgeConfig) *Bridge {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	b := NewBridge(config)
+	t.Cleanup(b.Close)
+	return b
+}
+
+func startBridge(t *testing.T, config BridgeConfig) *Bridge {
+	b := newTestBridge(t, config)
+	b.Start()
+	return b
+}
+
+// waitReport waits for the bridge to report news containing text.
+func waitReport(t *testing.T, sub *Subscription, text string) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case msg := <-sub.Messages():
+			if msg.Channel == "" && strings.Contains(msg.Text, text) {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("no report containing %q", text)
+		}
+	}
+}
+
+func waitConnected(t *testing.T, b *Bridge) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for b.State() != StateConnected {
+		if time.Now().After(deadline) {
+			t.Fatalf("bridge is %s, want connected", b.State())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestValidateSASLMechanism(t *testing.T) {
+	tests := []struct {
+		name   string
+		config BridgeConfig
+		ok     bool
+	}{
+		{"none", BridgeConfig{}, true},
+		{"plain", BridgeConfig{SASL: SASLConfig{Mechanism: "plain"}}, true},
+		{"PLAIN", BridgeConfig{SASL: SASLConfig{Mechanism: "PLAIN"}}, true},
+		{"external", BridgeConfig{UseSSL: true, ClientCert: "bbs.pem", SASL: SASLConfig{Mechanism: "external"}}, true},
+		{"external without TLS", BridgeConfig{ClientCert: "bbs.pem", SASL: SASLConfig{Mechanism: "external"}}, false},
+		{"external without a certificate", BridgeConfig{UseSSL: true, SASL: SASLConfig{Mechanism: "EXTERNAL"}}, false},
+		{"scram-sha-256", BridgeConfig{SASL: SASLConfig{Mechanism: "scram-sha-256"}}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.config.Validate(); (err == nil) != tt.ok {
+			t.Errorf("Validate() for %s = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestSASLPlain(t *testing.T) {
+	srv := newFakeServer(t)
+	config := srv.config()
+	config.SASL = SASLConfig{Mechanism: "plain", Username: "account", Password: "secret"}
+	config.NickServPassword = "nickserv"
+	startBridge(t, config)
+
+	c := srv.accept(t)
+	c.expect("CAP LS")
+	c.send(":irc.test CAP * LS :multi-prefix sasl")
+	c.expect("CAP REQ :sasl")
+	c.send(":irc.test CAP * ACK :sasl")
+	c.expect("AUTHENTICATE PLAIN")
+	c.send("AUTHENTICATE +")
+	line, _ := c.expect("AUTHENTICATE ")
+	want := "AUTHENTICATE " + base64.StdEncoding.EncodeToString([]byte("account\x00account\x00secret"))
+	if line != want {
+		t.Errorf("got %q, want %q", line, want)
+	}
+	c.send(":irc.test 900 bbs bbs!bbs@host account :You are now logged in as account")
+	c.send(":irc.test 903 bbs :SASL authentication successful")
+	c.expect("CAP END")
+	c.expect("NICK bbs")
+	c.send(":irc.test 001 bbs :Welcome")
+
+	_, skipped := c.expect("JOIN #bbs")
+	for _, line := range skipped {
+		if strings.Contains(line, "NickServ") {
+			t.Errorf("identified with NickServ after SASL succeeded: %q", line)
+		}
+	}
+}
+
+func TestSASLExternal(t *testing.T) {
+	serverCert := newTestCert(t, "irc.test")
+	clientCert := newTestCert(t, "bbs")
+	srv := newFakeTLSServer(t, &tls.Config{
+		Certificates: []tls.Certificate{serverCert.certificate()},
+		ClientAuth:   tls.RequireAnyClientCert,
+	})
+	config := srv.config()
+	config.UseSSL = true
+	config.TLSFingerprint = serverCert.fingerprint()
+	config.ClientCert = clientCert.writePEM(t)
+	config.SASL = SASLConfig{Mechanism: "external"}
+	config.NickServPassword = "nickserv"
+	startBridge(t, config)
+
+	c := srv.accept(t)
+	c.expect("CAP LS")
+	c.send(":irc.test CAP * LS :multi-prefix sasl=PLAIN,EXTERNAL")
+	c.expect("CAP REQ :sasl")
+	c.send(":irc.test CAP * ACK :sasl")
+	line, _ := c.expect("AUTHENTICATE ")
+	if want := "AUTHENTICATE EXTERNAL"; line != want {
+		t.Errorf("got %q, want %q", line, want)
+	}
+	c.send("AUTHENTICATE +")
+	line, _ = c.expect("AUTHENTICATE ")
+	if want := "AUTHENTICATE +"; line != want {
+		t.Errorf("got %q, want %q", line, want)
+	}
+	// The server knows the bridge by the certificate it presented
+	peer := c.conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(peer) == 0 || !bytes.Equal(peer[0].Raw, clientCert.der) {
+		t.Error("the bridge did not present its client certificate")
+	}
+	c.send(":irc.test 900 bbs bbs!bbs@host bbs :You are now logged in as bbs")
+	c.send(":irc.test 903 bbs :SASL authentication successful")
+	c.expect("CAP END")
+	c.expect("NICK bbs")
+	c.send(":irc.test 001 bbs :Welcome")
+
+	_, skipped := c.expect("JOIN #bbs")
+	for _, line := range skipped {
+		if strings.Contains(line, "NickServ") {
+			t.Errorf("identified with NickServ after SASL succeeded: %q", line)
+		}
+	}
+}
+
+func TestSASLRejectedFallsBackToNickServ(t *testing.T) {
+	srv := newFakeServer(t)
+	config := srv.config()
+	config.SASL = SASLConfig{Mechanism: "plain", Username: "account", Password: "wrong"}
+	config.NickServPassword = "nickserv"
+	startBridge(t, config)
+
+	c := srv.accept(t)
+	c.expect("CAP LS")
+	c.send(":irc.test CAP * LS :sasl")
+	c.expect("CAP REQ :sasl")
+	c.send(":irc.test CAP * ACK :sasl")
+	c.expect("AUTHENTICATE PLAIN")
+	c.send(":irc.test 904 bbs :SASL authentication failed")
+
+	// The failed connection must be hung up rather than left open
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if _, err := c.r.ReadString('\n'); err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				t.Fatal("the connection that failed SASL was not closed")
+			}
+			break
+		}
+	}
+
+	c = srv.accept(t)
+	line, skipped := c.expect("NICK bbs")
+	for _, line := range skipped {
+		if strings.HasPrefix(line, "CAP") {
+			t.Errorf("tried SASL again after it was rejected: %q", line)
+		}
+	}
+	c.expect("USER ")
+	c.send(":irc.test 001 bbs :Welcome")
+	line, _ = c.expect("PRIVMSG NickServ ")
+	if want := "PRIVMSG NickServ :IDENTIFY account nickserv"; line != want {
+		t.Errorf("got %q, want %q", line, want)
+	}
+	c.expect("JOIN #bbs")
+}
+
+func TestSASLNotOfferedFallsBack(t *testing.T) {
+	srv := newFakeServer(t)
+	config := srv.config()
+	config.SASL = SASLConfig{Mechanism: "plain", Password: "secret"}
+	b := newTestBridge(t, config)
+	sub := b.Subscribe()
+	defer sub.Close()
+	b.Start()
+
+	c := srv.accept(t)
+	c.expect("CAP LS")
+	c.send(":irc.test CAP * LS :multi-prefix away-notify")
+	waitReport(t, sub, "SASL authentication failed (the server does not support SASL)")
+
+	c = srv.accept(t)
+	_, skipped := c.expect("NICK bbs")
+	for _, line := range skipped {
+		if strings.HasPrefix(line, "CAP") {
+			t.Errorf("tried SASL again on a server without it: %q", line)
+		}
+	}
+}
+
+func TestConnectFailureKeepsSASL(t *testing.T) {
+	// Find a free port and leave nothing listening on it for the first try
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	config := (&fakeServer{ln: ln}).config()
+	config.SASL = SASLConfig{Mechanism: "plain", Password: "secret"}
+	b := newTestBridge(t, config)
+	sub := b.Subscribe()
+	defer sub.Close()
+	b.Start()
+	waitReport(t, sub, "Could not connect")
+
+	ln, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("cannot listen on %s again: %v", addr, err)
+	}
+	// SASL is still in use on the next try
+	c := serveFake(t, ln).accept(t)
+	c.expect("CAP LS")
+	c.send(":irc.test 904 bbs :SASL authentication failed")
+}
+
+func TestSASLRetriedAfterDelay(t *testing.T) {
+	b := &Bridge{Config: BridgeConfig{SASL: SASLConfig{Mechanism: "plain"}}}
+	if !b.useSASL() {
+		t.Fatal("SASL not used to begin with")
+	}
+	b.saslRetry = time.Now().Add(time.Minute)
+	if b.useSASL() {
+		t.Error("SASL used right after the server turned it down")
+	}
+	b.saslRetry = time.Now().Add(-time.Second)
+	if !b.useSASL() {
+		t.Error("SASL not tried again once the delay has passed")
+	}
+}
+
+func TestNickTakenTriesAltNicks(t *testing.T) {
+	srv := newFakeServer(t)
+	config := srv.config()
+	config.AltNicks = []string{"bbs_", "bbsbot"}
+	b := startBridge(t, config)
+
+	c := srv.accept(t)
+	c.expect("NICK bbs")
+	c.send(":irc.test 433 * bbs :Nickname is already in use")
+	c.expect("NICK bbs_")
+	c.send(":irc.test 433 * bbs_ :Nickname is already in use")
+	c.expect("NICK bbsbot")
+	c.send(":irc.test 001 bbsbot :Welcome")
+	c.expect("JOIN #bbs")
+	waitConnected(t, b)
+
+	// Our own messages are echoed under the nick we actually got
+	sub := b.Subscribe()
+	defer sub.Close()
+	if err := b.SendMessage("#bbs", "alice", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	c.expect("PRIVMSG #bbs :<alice> hello")
+	if msg := <-sub.Messages(); msg.Nick != "bbsbot" {
+		t.Errorf("echo came from %q, want bbsbot", msg.Nick)
+	}
+}
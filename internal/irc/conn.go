@@ -0,0 +1,263 @@
+package irc
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	ircevent "github.com/thoj/go-ircevent"
+)
+
+// State is where the bridge's link to the IRC server stands.
+type State int
+
+const (
+	StateDisconnected State = iota
+	StateConnecting
+	StateConnected
+)
+
+func (s State) String() string {
+	switch s {
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	default:
+		return "disconnected"
+	}
+}
+
+const (
+	defaultConnectTimeout = 30 * time.Second
+	minReconnectDelay     = 2 * time.Second
+	maxReconnectDelay     = 5 * time.Minute
+	// quitTimeout is how long Close waits for the server to hang up after
+	// QUIT
+	quitTimeout = 5 * time.Second
+)
+
+var errClosed = errors.New("bridge closed")
+
+// Start connects to the IRC server in the background. Whenever the link
+// cannot be made or drops, it is retried with exponential backoff and the
+// channels are joined again, until Close is called.
+func (b *Bridge) Start() {
+	b.mu.Lock()
+	b.started = true
+	b.mu.Unlock()
+	go b.supervise()
+}
+
+// State reports whether the bridge is connected.
+func (b *Bridge) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *Bridge) supervise() {
+	defer close(b.done)
+
+	delay := minReconnectDelay
+	for {
+		b.setState(StateConnecting)
+		conn, err := b.connect()
+		lost := err == nil
+		if lost {
+			delay = minReconnectDelay
+			err = b.serve(conn)
+		}
+		b.setState(StateDisconnected)
+		if err == errClosed {
+			return
+		}
+
+		if lost {
+			b.report("Lost the connection to %s: %v. Reconnecting in %s", b.Config.Server, err, delay)
+		} else {
+			b.report("Could not connect to %s: %v. Retrying in %s", b.Config.Server, err, delay)
+		}
+
+		select {
+		case <-b.quit:
+			return
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+// connect dials the server and waits for it to accept our registration.
+func (b *Bridge) connect() (*ircevent.Connection, error) {
+	useSASL := b.useSASL()
+	conn, err := b.newConnection(useSASL)
+	if err != nil {
+		return nil, err
+	}
+	registered := make(chan struct{})
+	conn.AddCallback("001", func(e *ircevent.Event) {
+		close(registered)
+	})
+	var rejected <-chan string
+	if useSASL {
+		rejected = watchSASL(conn)
+	}
+
+	if err := conn.Connect(fmt.Sprintf("%s:%d", b.Config.Server, b.Config.Port)); err != nil {
+		hangUp(conn)
+		// Only the server turning SASL down is a reason to go without it;
+		// anything else, such as the network, is simply retried
+		select {
+		case reason := <-rejected:
+			b.fallBackFromSASL(errors.New(reason))
+		default:
+		}
+		return nil, err
+	}
+
+	select {
+	case <-registered:
+		return conn, nil
+	case reason := <-rejected:
+		hangUp(conn)
+		err := errors.New(reason)
+		b.fallBackFromSASL(err)
+		return nil, err
+	case err := <-conn.ErrorChan():
+		hangUp(conn)
+		return nil, err
+	case <-time.After(b.connectTimeout()):
+		hangUp(conn)
+		return nil, fmt.Errorf("no welcome from the server within %s", b.connectTimeout())
+	case <-b.quit:
+		hangUp(conn)
+		return nil, errClosed
+	}
+}
+
+// serve keeps conn as the bridge's link until it fails or the bridge is
+// closed.
+func (b *Bridge) serve(conn *ircevent.Connection) error {
+	b.mu.Lock()
+	b.conn = conn
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		b.conn = nil
+		b.mu.Unlock()
+	}()
+
+	b.setState(StateConnected)
+	b.report("Connected to %s", b.Config.Server)
+
+	select {
+	case err := <-conn.ErrorChan():
+		hangUp(conn)
+		return err
+	case <-b.quit:
+		conn.Quit()
+		select {
+		case <-conn.ErrorChan():
+		case <-time.After(quitTimeout):
+		}
+		hangUp(conn)
+		return errClosed
+	}
+}
+
+// hangUp tears down a connection in the background, since ircevent waits
+// for its reader goroutine to notice, which can take until the next read
+// deadline.
+func hangUp(conn *ircevent.Connection) {
+	go conn.Disconnect()
+}
+
+func (b *Bridge) newConnection(useSASL bool) (*ircevent.Connection, error) {
+	conn := ircevent.IRC(b.Config.Nick, b.username())
+	conn.RealName = b.realName()
+	if b.Config.UseSSL {
+		tlsConfig, err := newTLSConfig(b.Config)
+		if err != nil {
+			return nil, err
+		}
+		conn.UseTLS = true
+		conn.TLSConfig = tlsConfig
+	}
+	conn.Timeout = b.connectTimeout()
+	b.setupNicks(conn)
+	if useSASL {
+		b.setupSASL(conn)
+	}
+
+	conn.AddCallback("001", func(e *ircevent.Event) {
+		log.Printf("Connected to IRC server as %s, joining channels...", e.Arguments[0])
+		if !useSASL {
+			b.identify(conn)
+		}
+		b.joinChannels(conn)
+	})
+
+	conn.AddCallback("JOIN", func(e *ircevent.Event) {
+		channel := e.Arguments[0]
+		log.Printf("Joined channel: %s", channel)
+	})
+
+	conn.AddCallback("KICK", func(e *ircevent.Event) {
+		channel := e.Arguments[0]
+		kicked := e.Arguments[1]
+		if kicked == conn.GetNick() {
+			log.Printf("Kicked from %s, attempting to rejoin in 3 seconds...", channel)
+			time.Sleep(3 * time.Second)
+			conn.Join(channel)
+		}
+	})
+
+	conn.AddCallback("PRIVMSG", func(e *ircevent.Event) {
+		b.hub.Publish(Message{
+			Time:    time.Now(),
+			Channel: e.Arguments[0],
+			Nick:    e.Nick,
+			Text:    sanitizeMessage(e.Message()),
+		})
+	})
+
+	conn.AddCallback("PING", func(e *ircevent.Event) {
+		conn.SendRaw("PONG :" + e.Message())
+	})
+
+	return conn, nil
+}
+
+func (b *Bridge) joinChannels(conn *ircevent.Connection) {
+	for _, channel := range b.Config.Channels {
+		if channel.Password != "" {
+			conn.Join(channel.Name + " " + channel.Password)
+		} else {
+			conn.Join(channel.Name)
+		}
+	}
+}
+
+func (b *Bridge) connectTimeout() time.Duration {
+	if b.Config.ConnectTimeout > 0 {
+		return time.Duration(b.Config.ConnectTimeout) * time.Second
+	}
+	return defaultConnectTimeout
+}
+
+func (b *Bridge) setState(state State) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = state
+}
+
+// report logs news about the link and passes it on to bridge users.
+func (b *Bridge) report(format string, args ...interface{}) {
+	text := fmt.Sprintf(format, args...)
+	log.Printf("IRC: %s", text)
+	b.hub.Publish(Message{Time: time.Now(), Text: text})
+}
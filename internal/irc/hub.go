@@ -0,0 +1,116 @@
+package irc
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Message is one line of IRC traffic. Messages without a channel are news
+// about the bridge itself, such as losing the connection.
+type Message struct {
+	Time    time.Time
+	Channel string
+	Nick    string
+	Text    string
+}
+
+// String formats the message the way it is written to the IRC log.
+func (m Message) String() string {
+	if m.Channel == "" {
+		return fmt.Sprintf("%s *** %s", m.Time.Format("2006-01-02 15:04:05"), m.Text)
+	}
+	return fmt.Sprintf("%s <%s> %s: %s", m.Time.Format("2006-01-02 15:04:05"), m.Channel, m.Nick, m.Text)
+}
+
+// Hub fans every published message out to all of its subscribers. Each
+// subscriber has its own buffer; one that falls behind loses messages
+// instead of holding up the others, and can ask how many it lost.
+type Hub struct {
+	mu     sync.Mutex
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+// Subscription receives the messages published on a hub after it was made.
+type Subscription struct {
+	hub     *Hub
+	ch      chan Message
+	dropped int
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: make(map[*Subscription]struct{})}
+}
+
+// Subscribe adds a subscriber with room for buffer messages it has not read
+// yet.
+func (h *Hub) Subscribe(buffer int) *Subscription {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sub := &Subscription{hub: h, ch: make(chan Message, buffer)}
+	if h.closed {
+		close(sub.ch)
+		return sub
+	}
+	h.subs[sub] = struct{}{}
+	return sub
+}
+
+// Publish hands msg to every subscriber without waiting on any of them.
+func (h *Hub) Publish(msg Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subs {
+		select {
+		case sub.ch <- msg:
+		default:
+			sub.dropped++
+		}
+	}
+}
+
+// Close ends every subscription. Later messages are discarded.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return
+	}
+	h.closed = true
+	for sub := range h.subs {
+		close(sub.ch)
+		delete(h.subs, sub)
+	}
+}
+
+// Messages returns the channel messages arrive on. It is closed when the
+// subscription or the hub is closed.
+func (s *Subscription) Messages() <-chan Message {
+	return s.ch
+}
+
+// Dropped returns how many messages were lost because the buffer was full
+// since the last call.
+func (s *Subscription) Dropped() int {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	n := s.dropped
+	s.dropped = 0
+	return n
+}
+
+// Close stops the subscription.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	if _, ok := s.hub.subs[s]; ok {
+		delete(s.hub.subs, s)
+		close(s.ch)
+	}
+}
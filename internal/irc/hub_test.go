@@ -0,0 +1,149 @@
+package irc
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestHubFansOutToEverySubscriber(t *testing.T) {
+	h := NewHub()
+	defer h.Close()
+	subs := []*Subscription{h.Subscribe(10), h.Subscribe(10), h.Subscribe(10)}
+
+	for i := 0; i < 3; i++ {
+		h.Publish(Message{Text: fmt.Sprint(i)})
+	}
+
+	for n, sub := range subs {
+		for i := 0; i < 3; i++ {
+			if msg := <-sub.Messages(); msg.Text != fmt.Sprint(i) {
+				t.Errorf("subscriber %d got %q, want %q", n, msg.Text, fmt.Sprint(i))
+			}
+		}
+		if d := sub.Dropped(); d != 0 {
+			t.Errorf("subscriber %d dropped %d messages", n, d)
+		}
+	}
+}
+
+func TestHubOnlyDeliversAfterSubscribe(t *testing.T) {
+	h := NewHub()
+	defer h.Close()
+	h.Publish(Message{Text: "before"})
+	sub := h.Subscribe(10)
+	h.Publish(Message{Text: "after"})
+
+	if msg := <-sub.Messages(); msg.Text != "after" {
+		t.Errorf("got %q, want %q", msg.Text, "after")
+	}
+}
+
+func TestHubDropsForFullSubscriber(t *testing.T) {
+	h := NewHub()
+	defer h.Close()
+	slow := h.Subscribe(2)
+	fast := h.Subscribe(10)
+
+	for i := 0; i < 5; i++ {
+		h.Publish(Message{Text: fmt.Sprint(i)})
+	}
+
+	if n := len(fast.Messages()); n != 5 {
+		t.Errorf("fast subscriber has %d messages, want 5", n)
+	}
+	if n := len(slow.Messages()); n != 2 {
+		t.Errorf("slow subscriber has %d messages, want 2", n)
+	}
+	// The slow subscriber keeps the oldest messages and loses the rest
+	for i := 0; i < 2; i++ {
+		if msg := <-slow.Messages(); msg.Text != fmt.Sprint(i) {
+			t.Errorf("slow subscriber got %q, want %q", msg.Text, fmt.Sprint(i))
+		}
+	}
+	if d := slow.Dropped(); d != 3 {
+		t.Errorf("Dropped() = %d, want 3", d)
+	}
+	if d := slow.Dropped(); d != 0 {
+		t.Errorf("Dropped() = %d after being read, want 0", d)
+	}
+
+	// Once it has caught up it receives again
+	h.Publish(Message{Text: "later"})
+	if msg := <-slow.Messages(); msg.Text != "later" {
+		t.Errorf("got %q, want %q", msg.Text, "later")
+	}
+}
+
+func TestHubUnsubscribe(t *testing.T) {
+	h := NewHub()
+	defer h.Close()
+	sub := h.Subscribe(10)
+	other := h.Subscribe(10)
+
+	sub.Close()
+	sub.Close()
+	if _, ok := <-sub.Messages(); ok {
+		t.Error("closed subscription still delivers")
+	}
+
+	h.Publish(Message{Text: "x"})
+	if n := len(other.Messages()); n != 1 {
+		t.Errorf("remaining subscriber has %d messages, want 1", n)
+	}
+}
+
+func TestHubUnsubscribeDuringPublish(t *testing.T) {
+	h := NewHub()
+	defer h.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				h.Publish(Message{Text: "x"})
+			}
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sub := h.Subscribe(1)
+			go func() {
+				for range sub.Messages() {
+				}
+			}()
+			sub.Dropped()
+			sub.Close()
+		}()
+	}
+	wg.Wait()
+}
+
+func TestHubClose(t *testing.T) {
+	h := NewHub()
+	sub := h.Subscribe(10)
+	h.Publish(Message{Text: "x"})
+	h.Close()
+	h.Close()
+
+	// What was buffered is still delivered before the channel closes
+	n := 0
+	for range sub.Messages() {
+		n++
+	}
+	if n != 1 {
+		t.Errorf("got %d messages, want 1", n)
+	}
+	sub.Close()
+
+	late := h.Subscribe(10)
+	h.Publish(Message{Text: "y"})
+	if _, ok := <-late.Messages(); ok {
+		t.Error("subscription to a closed hub delivers")
+	}
+	late.Close()
+}
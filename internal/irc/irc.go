@@ -2,7 +2,7 @@ package irc
 
 import (
 	"bufio"
-	"crypto/tls"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -22,6 +22,63 @@ type BridgeConfig struct {
 	UseSSL   bool      `json:"use_ssl"`
 	Nick     string    `json:"nick"`
 	Channels []Channel `json:"channels"`
+	// ConnectTimeout is how many seconds a connection attempt may take,
+	// from dialing until the server welcomes us.
+	ConnectTimeout int `json:"connect_timeout"`
+
+	// AltNicks are tried in order when Nick is taken.
+	AltNicks []string `json:"alt_nicks"`
+	// Username and RealName default to Nick.
+	Username string `json:"username"`
+	RealName string `json:"realname"`
+
+	SASL SASLConfig `json:"sasl"`
+	// NickServPassword is sent to NickServ with IDENTIFY after connecting
+	// when SASL is not configured or has failed.
+	NickServPassword string `json:"nickserv_password"`
+	// TLSCAFile is a PEM bundle of CAs to trust instead of the system ones.
+	TLSCAFile string `json:"tls_ca_file"`
+	// TLSFingerprint pins the server's certificate by the SHA-256 hash of
+	// its DER encoding, in hex with or without colons. A pinned certificate
+	// is trusted whoever signed it.
+	TLSFingerprint string `json:"tls_fingerprint"`
+	// TLSInsecure turns certificate verification off entirely, and so
+	// cannot be combined with TLSFingerprint.
+	TLSInsecure bool `json:"tls_insecure"`
+	// ClientCert and ClientKey are PEM files with the certificate presented
+	// to the server, for SASL EXTERNAL or networks that recognise it by
+	// fingerprint (CertFP). ClientKey defaults to ClientCert for a file
+	// holding both.
+	ClientCert string `json:"client_cert"`
+	ClientKey  string `json:"client_key"`
+}
+
+// SASLConfig selects SASL authentication. Mechanism is "plain" or
+// "external"; empty disables SASL. Username defaults to Nick and Password
+// is only used by PLAIN.
+type SASLConfig struct {
+	Mechanism string `json:"mechanism"`
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+}
+
+// Validate reports settings that could never work, so that they are caught
+// when the config is loaded rather than on every connection attempt.
+func (c BridgeConfig) Validate() error {
+	// With verification off the pin would be silently ignored
+	if c.TLSInsecure && c.TLSFingerprint != "" {
+		return errors.New("tls_insecure and tls_fingerprint cannot both be set")
+	}
+	switch strings.ToLower(c.SASL.Mechanism) {
+	case "", "plain":
+	case "external":
+		if !c.UseSSL || c.ClientCert == "" {
+			return errors.New("SASL EXTERNAL needs use_ssl and a client_cert")
+		}
+	default:
+		return fmt.Errorf("unsupported SASL mechanism %q, use \"plain\" or \"external\"", c.SASL.Mechanism)
+	}
+	return nil
 }
 
 type Channel struct {
@@ -31,28 +88,52 @@ type Channel struct {
 
 type Bridge struct {
 	Config      BridgeConfig
-	conn        *ircevent.Connection
-	msgChan     chan string
-	connected   sync.WaitGroup
+	hub         *Hub
+	loggerDone  chan struct{}
+	quit        chan struct{}
+	done        chan struct{}
 	logFile     *os.File
 	logMutex    sync.Mutex
 	currentDate string
+
+	mu      sync.Mutex
+	conn    *ircevent.Connection
+	state   State
+	started bool
+	// saslRetry is when SASL is tried again after the server turned it down
+	saslRetry time.Time
 }
 
+// ErrNotConnected is returned when sending while the bridge is offline.
+var ErrNotConnected = errors.New("not connected to IRC")
+
 func NewBridge(config BridgeConfig) *Bridge {
 	bridge := &Bridge{
 		Config:      config,
-		msgChan:     make(chan string, 1000),
+		hub:         NewHub(),
+		loggerDone:  make(chan struct{}),
+		quit:        make(chan struct{}),
+		done:        make(chan struct{}),
 		currentDate: time.Now().Format("2006-01-02"),
 	}
-	bridge.connected.Add(1)
-	go bridge.messageLogger()
+	go bridge.messageLogger(bridge.hub.Subscribe(logBuffer))
 	return bridge
 }
 
-func (b *Bridge) messageLogger() {
-	for msg := range b.msgChan {
-		b.logMessage(msg)
+const (
+	// logBuffer is how far the log file may fall behind the IRC server
+	logBuffer = 1000
+	// subscriberBuffer is how far a bridge user may fall behind
+	subscriberBuffer = 100
+)
+
+func (b *Bridge) messageLogger(sub *Subscription) {
+	defer close(b.loggerDone)
+	for msg := range sub.Messages() {
+		if n := sub.Dropped(); n > 0 {
+			log.Printf("IRC log fell behind, %d messages were not logged", n)
+		}
+		b.logMessage(msg.String())
 	}
 }
 
@@ -87,78 +168,53 @@ func (b *Bridge) logMessage(msg string) {
 	}
 }
 
-func (b *Bridge) Connect() error {
-	b.conn = ircevent.IRC(b.Config.Nick, b.Config.Nick)
-	b.conn.UseTLS = b.Config.UseSSL
-	b.conn.TLSConfig = &tls.Config{InsecureSkipVerify: true}
-
-	b.conn.AddCallback("001", func(e *ircevent.Event) {
-		log.Println("Connected to IRC server, joining channels...")
-		b.connected.Done()
-		b.joinChannels()
-	})
-
-	b.conn.AddCallback("JOIN", func(e *ircevent.Event) {
-		channel := e.Arguments[0]
-		log.Printf("Joined channel: %s", channel)
-	})
-
-	b.conn.AddCallback("KICK", func(e *ircevent.Event) {
-		channel := e.Arguments[0]
-		kicked := e.Arguments[1]
-		if kicked == b.Config.Nick {
-			log.Printf("Kicked from %s, attempting to rejoin in 3 seconds...", channel)
-			time.Sleep(3 * time.Second)
-			b.conn.Join(channel)
-		}
-	})
-
-	b.conn.AddCallback("PRIVMSG", func(e *ircevent.Event) {
-		msg := fmt.Sprintf("%s <%s> %s: %s",
-			time.Now().Format("2006-01-02 15:04:05"),
-			e.Arguments[0], e.Nick, sanitizeMessage(e.Message()))
-		select {
-		case b.msgChan <- msg:
-		default:
-			log.Printf("Message channel full, dropping message: %s", msg)
-		}
-	})
-
-	b.conn.AddCallback("PING", func(e *ircevent.Event) {
-		b.conn.SendRaw("PONG :" + e.Message())
-	})
-
-	err := b.conn.Connect(fmt.Sprintf("%s:%d", b.Config.Server, b.Config.Port))
-	if err != nil {
-		return err
+// Channels returns the names of the bridged channels.
+func (b *Bridge) Channels() []string {
+	var names []string
+	for _, channel := range b.Config.Channels {
+		names = append(names, channel.Name)
 	}
-
-	go b.conn.Loop()
-
-	b.connected.Wait()
-
-	return nil
+	return names
 }
 
-func (b *Bridge) joinChannels() {
+// Channel returns the bridged channel called name, compared without regard
+// to case as IRC does.
+func (b *Bridge) Channel(name string) (string, bool) {
 	for _, channel := range b.Config.Channels {
-		if channel.Password != "" {
-			b.conn.Join(channel.Name + " " + channel.Password)
-		} else {
-			b.conn.Join(channel.Name)
+		if strings.EqualFold(channel.Name, name) {
+			return channel.Name, true
 		}
 	}
+	return "", false
 }
 
-func (b *Bridge) SendMessage(channel, sender, message string) {
-	b.conn.Privmsg(channel, fmt.Sprintf("<%s> %s", sender, message))
+// SendMessage says message on channel on behalf of sender.
+func (b *Bridge) SendMessage(channel, sender, message string) error {
+	b.mu.Lock()
+	conn := b.conn
+	b.mu.Unlock()
+	if conn == nil {
+		return ErrNotConnected
+	}
+
+	text := fmt.Sprintf("<%s> %s", sender, message)
+	conn.Privmsg(channel, text)
+
+	// The server does not echo our own messages, so hand them to the other
+	// bridge users and the log here, under whichever nick we ended up with
+	b.hub.Publish(Message{Time: time.Now(), Channel: channel, Nick: conn.GetNick(), Text: text})
+	return nil
 }
 
-func (b *Bridge) GetMessageChannel() <-chan string {
-	return b.msgChan
+// Subscribe returns a subscription to the IRC traffic that arrives from now
+// on. The caller must close it when done.
+func (b *Bridge) Subscribe() *Subscription {
+	return b.hub.Subscribe(subscriberBuffer)
 }
 
-func (b *Bridge) GetRecentMessages(count int) ([]string, error) {
+// GetRecentMessages returns up to count of today's logged messages from
+// channel, or from every channel if channel is empty.
+func (b *Bridge) GetRecentMessages(channel string, count int) ([]string, error) {
 	b.logMutex.Lock()
 	defer b.logMutex.Unlock()
 
@@ -172,7 +228,10 @@ func (b *Bridge) GetRecentMessages(count int) ([]string, error) {
 	var messages []string
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
-		messages = append(messages, scanner.Text())
+		line := scanner.Text()
+		if channel == "" || strings.EqualFold(logLineChannel(line), channel) {
+			messages = append(messages, line)
+		}
 	}
 
 	if err := scanner.Err(); err != nil {
@@ -185,6 +244,19 @@ func (b *Bridge) GetRecentMessages(count int) ([]string, error) {
 	return messages[len(messages)-count:], nil
 }
 
+// logLineChannel returns the channel of a line written by Message.String.
+func logLineChannel(line string) string {
+	prefix := len("2006-01-02 15:04:05 <")
+	if len(line) < prefix || line[prefix-1] != '<' {
+		return ""
+	}
+	rest := line[prefix:]
+	if i := strings.Index(rest, "> "); i >= 0 {
+		return rest[:i]
+	}
+	return ""
+}
+
 func sanitizeMessage(message string) string {
 	if !utf8.ValidString(message) {
 		return strings.ToValidUTF8(message, "\uFFFD")
@@ -192,12 +264,23 @@ func sanitizeMessage(message string) string {
 	return message
 }
 
+// Close leaves IRC and stops the bridge.
 func (b *Bridge) Close() {
-	if b.conn != nil {
-		b.conn.Quit()
+	close(b.quit)
+	b.mu.Lock()
+	started := b.started
+	b.mu.Unlock()
+	if started {
+		<-b.done
 	}
-	close(b.msgChan)
+
+	b.hub.Close()
+	<-b.loggerDone
+
+	b.logMutex.Lock()
+	defer b.logMutex.Unlock()
 	if b.logFile != nil {
 		b.logFile.Close()
+		b.logFile = nil
 	}
 }
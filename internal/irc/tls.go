@@ -0,0 +1,85 @@
+package irc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// newTLSConfig builds the TLS settings for connecting to the IRC server.
+// The server certificate is verified against the system roots, or the
+// configured CA bundle, unless it is pinned by fingerprint or verification
+// is explicitly turned off.
+func newTLSConfig(config BridgeConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName: config.Server,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if config.TLSCAFile != "" {
+		pem, err := os.ReadFile(config.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read IRC CA bundle: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in IRC CA bundle %s", config.TLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	switch {
+	case config.TLSInsecure:
+		log.Printf("IRC TLS certificate verification is disabled")
+		tlsConfig.InsecureSkipVerify = true
+	case config.TLSFingerprint != "":
+		pin, err := parseFingerprint(config.TLSFingerprint)
+		if err != nil {
+			return nil, err
+		}
+		// The pin replaces the usual chain verification, which would turn
+		// down the self-signed certificates many IRC servers use
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return errors.New("server sent no certificate")
+			}
+			sum := sha256.Sum256(rawCerts[0])
+			if !bytes.Equal(sum[:], pin) {
+				return fmt.Errorf("server certificate fingerprint %s does not match the pinned one", hex.EncodeToString(sum[:]))
+			}
+			return nil
+		}
+	}
+
+	if config.ClientCert != "" {
+		key := config.ClientKey
+		if key == "" {
+			key = config.ClientCert
+		}
+		cert, err := tls.LoadX509KeyPair(config.ClientCert, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load IRC client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// parseFingerprint decodes a SHA-256 fingerprint written as hex, with or
+// without colons between the bytes.
+func parseFingerprint(s string) ([]byte, error) {
+	pin, err := hex.DecodeString(strings.ReplaceAll(strings.TrimSpace(s), ":", ""))
+	if err != nil || len(pin) != sha256.Size {
+		return nil, fmt.Errorf("invalid IRC TLS fingerprint %q, expected a SHA-256 hash in hex", s)
+	}
+	return pin, nil
+}
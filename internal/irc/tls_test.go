@@ -0,0 +1,235 @@
+package irc
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCert is a self-signed certificate for localhost, good for either end
+// of a TLS connection.
+type testCert struct {
+	der []byte
+	key *ecdsa.PrivateKey
+}
+
+func newTestCert(t *testing.T, name string) testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testCert{der: der, key: key}
+}
+
+func (c testCert) certificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+func (c testCert) fingerprint() string {
+	sum := sha256.Sum256(c.der)
+	return hex.EncodeToString(sum[:])
+}
+
+// writePEM writes the certificate and its key to one file, the way
+// client_cert can be given.
+func (c testCert) writePEM(t *testing.T) string {
+	t.Helper()
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der})
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})...)
+	return writeFile(t, "client.pem", data)
+}
+
+// serveSelfSigned listens on 127.0.0.1 with a self-signed certificate for
+// localhost and returns the address and the certificate's DER encoding.
+func serveSelfSigned(t *testing.T) (string, []byte) {
+	t.Helper()
+	cert := newTestCert(t, "localhost")
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert.certificate()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				conn.(*tls.Conn).Handshake()
+				conn.Close()
+			}()
+		}
+	}()
+	return ln.Addr().String(), cert.der
+}
+
+func writeFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestTLSVerification(t *testing.T) {
+	addr, der := serveSelfSigned(t)
+	caFile := writeFile(t, "ca.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	sum := sha256.Sum256(der)
+	fingerprint := hex.EncodeToString(sum[:])
+	wrong := sha256.Sum256([]byte("some other certificate"))
+
+	tests := []struct {
+		name   string
+		config BridgeConfig
+		ok     bool
+	}{
+		{"default", BridgeConfig{}, false},
+		{"CA file", BridgeConfig{TLSCAFile: caFile}, true},
+		{"fingerprint", BridgeConfig{TLSFingerprint: fingerprint}, true},
+		{"fingerprint with colons", BridgeConfig{TLSFingerprint: colonHex(sum[:])}, true},
+		{"wrong fingerprint", BridgeConfig{TLSFingerprint: hex.EncodeToString(wrong[:])}, false},
+		{"insecure", BridgeConfig{TLSInsecure: true}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Server = "localhost"
+			tlsConfig, err := newTLSConfig(tt.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			conn, err := tls.Dial("tcp", addr, tlsConfig)
+			if err == nil {
+				conn.Close()
+			}
+			if (err == nil) != tt.ok {
+				t.Errorf("handshake error = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestTLSConfigErrors(t *testing.T) {
+	empty := writeFile(t, "empty.pem", []byte("no certificates here\n"))
+
+	tests := []struct {
+		name   string
+		config BridgeConfig
+	}{
+		{"malformed fingerprint", BridgeConfig{TLSFingerprint: "zz"}},
+		{"short fingerprint", BridgeConfig{TLSFingerprint: "ab:cd:ef"}},
+		{"empty CA bundle", BridgeConfig{TLSCAFile: empty}},
+		{"missing CA bundle", BridgeConfig{TLSCAFile: filepath.Join(t.TempDir(), "missing.pem")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Server = "localhost"
+			if _, err := newTLSConfig(tt.config); err == nil {
+				t.Error("newTLSConfig succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestValidateTLS(t *testing.T) {
+	config := BridgeConfig{UseSSL: true, TLSInsecure: true, TLSFingerprint: strings.Repeat("ab", 32)}
+	if err := config.Validate(); err == nil {
+		t.Error("Validate() accepted tls_insecure with tls_fingerprint")
+	}
+	config.TLSInsecure = false
+	if err := config.Validate(); err != nil {
+		t.Errorf("Validate() with only tls_fingerprint = %v", err)
+	}
+}
+
+// TestTLSRegistration connects the bridge over TLS and sees it through
+// registration to joining its channel, with and without a client
+// certificate.
+func TestTLSRegistration(t *testing.T) {
+	serverCert := newTestCert(t, "irc.test")
+	clientCert := newTestCert(t, "bbs")
+
+	tests := []struct {
+		name       string
+		clientCert *testCert
+	}{
+		{"without client certificate", nil},
+		{"with client certificate", &clientCert},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newFakeTLSServer(t, &tls.Config{
+				Certificates: []tls.Certificate{serverCert.certificate()},
+				ClientAuth:   tls.RequestClientCert,
+			})
+			config := srv.config()
+			config.UseSSL = true
+			config.TLSFingerprint = serverCert.fingerprint()
+			if tt.clientCert != nil {
+				config.ClientCert = tt.clientCert.writePEM(t)
+			}
+			b := startBridge(t, config)
+
+			c := srv.accept(t)
+			c.expect("NICK bbs")
+			c.expect("USER bbs ")
+			c.send(":irc.test 001 bbs :Welcome")
+			c.expect("JOIN #bbs")
+			waitConnected(t, b)
+
+			peer := c.conn.(*tls.Conn).ConnectionState().PeerCertificates
+			switch {
+			case tt.clientCert == nil && len(peer) != 0:
+				t.Error("the bridge presented a client certificate it was not given")
+			case tt.clientCert != nil && (len(peer) == 0 || !bytes.Equal(peer[0].Raw, tt.clientCert.der)):
+				t.Error("the bridge did not present its client certificate")
+			}
+		})
+	}
+}
+
+func colonHex(b []byte) string {
+	parts := make([]string, len(b))
+	for i := range b {
+		parts[i] = strings.ToUpper(hex.EncodeToString(b[i : i+1]))
+	}
+	return strings.Join(parts, ":")
+}
@@ -0,0 +1,199 @@
+package mail
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"gbbs/internal/user"
+)
+
+const (
+	// MaxSubjectLength is the longest subject Send accepts, in bytes.
+	MaxSubjectLength = 80
+	maxBodyLength    = 16000
+)
+
+var (
+	ErrNoSuchUser   = errors.New("no such user")
+	ErrMailNotFound = errors.New("mail not found")
+)
+
+type Mail struct {
+	ID      int64      `json:"id"`
+	From    string     `json:"from"`
+	To      string     `json:"to"`
+	Subject string     `json:"subject"`
+	Body    string     `json:"body,omitempty"`
+	Sent    time.Time  `json:"sent"`
+	Read    *time.Time `json:"read,omitempty"`
+}
+
+// Manager stores private mail. Each message lives in the recipient's inbox
+// and the sender's sent folder; deleting it from one leaves the other.
+type Manager struct {
+	db    *sql.DB
+	users *user.Manager
+}
+
+func NewManager(dbPath string, users *user.Manager) (*Manager, error) {
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS mail (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            sender TEXT NOT NULL,
+            recipient TEXT NOT NULL,
+            subject TEXT NOT NULL,
+            body TEXT NOT NULL,
+            sent_at DATETIME NOT NULL,
+            read_at DATETIME,
+            sender_deleted INTEGER NOT NULL DEFAULT 0,
+            recipient_deleted INTEGER NOT NULL DEFAULT 0
+        );
+        CREATE INDEX IF NOT EXISTS idx_mail_recipient ON mail (recipient, recipient_deleted, id);
+        CREATE INDEX IF NOT EXISTS idx_mail_sender ON mail (sender, sender_deleted, id);
+    `)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Manager{db: db, users: users}, nil
+}
+
+func (m *Manager) Close() error {
+	return m.db.Close()
+}
+
+func (m *Manager) Send(from, to, subject, body string) (*Mail, error) {
+	subject = strings.TrimSpace(subject)
+	if subject == "" {
+		return nil, fmt.Errorf("subject cannot be empty")
+	}
+	if len(subject) > MaxSubjectLength {
+		return nil, fmt.Errorf("subject too long (max %d characters)", MaxSubjectLength)
+	}
+	if len(body) == 0 {
+		return nil, fmt.Errorf("message cannot be empty")
+	}
+	if len(body) > maxBodyLength {
+		return nil, fmt.Errorf("message too long (max %d characters)", maxBodyLength)
+	}
+
+	exists, err := m.users.Exists(to)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNoSuchUser
+	}
+
+	mail := &Mail{From: from, To: to, Subject: subject, Body: body, Sent: time.Now()}
+	result, err := m.db.Exec("INSERT INTO mail (sender, recipient, subject, body, sent_at) VALUES (?, ?, ?, ?, ?)",
+		mail.From, mail.To, mail.Subject, mail.Body, mail.Sent)
+	if err != nil {
+		return nil, err
+	}
+	mail.ID, err = result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return mail, nil
+}
+
+const mailColumns = "id, sender, recipient, subject, body, sent_at, read_at"
+
+func (m *Manager) query(query string, args ...interface{}) ([]Mail, error) {
+	rows, err := m.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mails []Mail
+	for rows.Next() {
+		mail, err := scanMail(rows)
+		if err != nil {
+			return nil, err
+		}
+		mails = append(mails, *mail)
+	}
+	return mails, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanMail(row scanner) (*Mail, error) {
+	var mail Mail
+	var read sql.NullTime
+	if err := row.Scan(&mail.ID, &mail.From, &mail.To, &mail.Subject, &mail.Body, &mail.Sent, &read); err != nil {
+		return nil, err
+	}
+	if read.Valid {
+		mail.Read = &read.Time
+	}
+	return &mail, nil
+}
+
+// Inbox returns the user's received mail, newest first.
+func (m *Manager) Inbox(username string) ([]Mail, error) {
+	return m.query("SELECT "+mailColumns+" FROM mail WHERE recipient = ? AND recipient_deleted = 0 ORDER BY id DESC", username)
+}
+
+// Sent returns the mail the user has sent, newest first. Read shows whether
+// the recipient has opened each one.
+func (m *Manager) Sent(username string) ([]Mail, error) {
+	return m.query("SELECT "+mailColumns+" FROM mail WHERE sender = ? AND sender_deleted = 0 ORDER BY id DESC", username)
+}
+
+// Get returns a mail the user sent or received and has not deleted.
+func (m *Manager) Get(username string, id int64) (*Mail, error) {
+	mail, err := scanMail(m.db.QueryRow(`
+        SELECT `+mailColumns+` FROM mail
+        WHERE id = ? AND ((recipient = ? AND recipient_deleted = 0) OR (sender = ? AND sender_deleted = 0))
+    `, id, username, username))
+	if err == sql.ErrNoRows {
+		return nil, ErrMailNotFound
+	}
+	return mail, err
+}
+
+// MarkRead records that the recipient opened the mail. Opening it again
+// keeps the original time.
+func (m *Manager) MarkRead(username string, id int64) error {
+	_, err := m.db.Exec("UPDATE mail SET read_at = ? WHERE id = ? AND recipient = ? AND read_at IS NULL", time.Now(), id, username)
+	return err
+}
+
+// Delete removes the mail from the user's inbox or sent folder.
+func (m *Manager) Delete(username string, id int64) error {
+	result, err := m.db.Exec(`
+        UPDATE mail SET
+            recipient_deleted = CASE WHEN recipient = ? THEN 1 ELSE recipient_deleted END,
+            sender_deleted = CASE WHEN sender = ? THEN 1 ELSE sender_deleted END
+        WHERE id = ? AND (recipient = ? OR sender = ?)
+    `, username, username, id, username, username)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrMailNotFound
+	}
+	return nil
+}
+
+func (m *Manager) UnreadCount(username string) (int, error) {
+	var count int
+	err := m.db.QueryRow("SELECT COUNT(*) FROM mail WHERE recipient = ? AND recipient_deleted = 0 AND read_at IS NULL", username).Scan(&count)
+	return count, err
+}
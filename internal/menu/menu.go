@@ -0,0 +1,174 @@
+package menu
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Built-in actions understood by every session. Anything else is looked up
+// in the session's action table.
+const (
+	ActionMenu   = "menu"
+	ActionBack   = "back"
+	ActionLogout = "logout"
+)
+
+type Item struct {
+	Key    string `json:"key"`
+	Label  string `json:"label"`
+	Action string `json:"action"`
+	Arg    string `json:"arg,omitempty"`
+	Level  int    `json:"level,omitempty"`
+}
+
+type Menu struct {
+	Title   string `json:"title"`
+	Screen  string `json:"screen,omitempty"`
+	Prompt  string `json:"prompt,omitempty"`
+	Hotkeys bool   `json:"hotkeys,omitempty"`
+	Level   int    `json:"level,omitempty"`
+	Items   []Item `json:"items"`
+}
+
+type Set struct {
+	Start string           `json:"start"`
+	Menus map[string]*Menu `json:"menus"`
+}
+
+// Default mirrors the menu the BBS shipped with before menus were
+// configurable, and is used when no menu file is present.
+func Default() *Set {
+	return &Set{
+		Start: "main",
+		Menus: map[string]*Menu{
+			"main": {
+				Title: "BBS Menu:",
+				Items: []Item{
+					{Key: "1", Label: "Read messages", Action: "read_messages"},
+					{Key: "2", Label: "Post message", Action: "post_message"},
+					{Key: "3", Label: "IRC Bridge", Action: "irc_bridge"},
+					{Key: "4", Label: "Logout", Action: ActionLogout},
+					{Key: "N", Label: "Scan for new messages", Action: "scan_new"},
+					{Key: "M", Label: "Private mail", Action: "mail"},
+					{Key: "T", Label: "Teleconference", Action: "teleconference"},
+					{Key: "P", Label: "Page a user", Action: "page_user"},
+					{Key: "C", Label: "Page the sysop", Action: "page_sysop"},
+					{Key: "W", Label: "Who's online", Action: "who_online"},
+					{Key: "B", Label: "Change message board", Action: "select_board"},
+					{Key: "A", Label: "Account settings", Action: ActionMenu, Arg: "account"},
+					{Key: "S", Label: "Sysop menu", Action: ActionMenu, Arg: "sysop", Level: 100},
+				},
+			},
+			"account": {
+				Title: "Account Settings:",
+				Items: []Item{
+					{Key: "1", Label: "Manage SSH keys", Action: "ssh_keys"},
+					{Key: "Q", Label: "Back", Action: ActionBack},
+				},
+			},
+			"sysop": {
+				Title: "Sysop Menu:",
+				Level: 100,
+				Items: []Item{
+					{Key: "1", Label: "List and manage users", Action: "admin_users"},
+					{Key: "2", Label: "Delete a message", Action: "admin_delete_message"},
+					{Key: "3", Label: "Who's online", Action: "who_online"},
+					{Key: "4", Label: "Disconnect a node", Action: "admin_disconnect"},
+					{Key: "5", Label: "Answer a page", Action: "answer_page"},
+					{Key: "Q", Label: "Back", Action: ActionBack},
+				},
+			},
+		},
+	}
+}
+
+func Load(path string) (*Set, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	set := &Set{}
+	if err := json.NewDecoder(file).Decode(set); err != nil {
+		return nil, fmt.Errorf("error decoding menu file: %v", err)
+	}
+	if set.Start == "" {
+		set.Start = "main"
+	}
+
+	// Screens are relative to the menu file, like paths in config.json
+	baseDir := filepath.Dir(path)
+	for _, m := range set.Menus {
+		if m.Screen != "" && !filepath.IsAbs(m.Screen) {
+			m.Screen = filepath.Join(baseDir, m.Screen)
+		}
+	}
+
+	if err := set.Validate(); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+func (s *Set) Validate() error {
+	if _, ok := s.Menus[s.Start]; !ok {
+		return fmt.Errorf("start menu %q is not defined", s.Start)
+	}
+	for name, m := range s.Menus {
+		if m == nil {
+			return fmt.Errorf("menu %q is empty", name)
+		}
+		seen := make(map[string]bool)
+		for _, item := range m.Items {
+			key := strings.ToLower(item.Key)
+			if key == "" {
+				return fmt.Errorf("menu %q: item %q has no key", name, item.Label)
+			}
+			if seen[key] {
+				return fmt.Errorf("menu %q: duplicate key %q", name, item.Key)
+			}
+			seen[key] = true
+			if item.Action == "" {
+				return fmt.Errorf("menu %q: item %q has no action", name, item.Key)
+			}
+			if item.Action == ActionMenu {
+				if _, ok := s.Menus[item.Arg]; !ok {
+					return fmt.Errorf("menu %q: item %q points to unknown menu %q", name, item.Key, item.Arg)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Set) Get(name string) *Menu {
+	return s.Menus[name]
+}
+
+// Lookup finds the item bound to key, ignoring case and any item the given
+// access level is not allowed to use.
+func (m *Menu) Lookup(key string, level int) *Item {
+	key = strings.TrimSpace(key)
+	for i := range m.Items {
+		item := &m.Items[i]
+		if strings.EqualFold(item.Key, key) && item.Level <= level {
+			return item
+		}
+	}
+	return nil
+}
+
+// Visible returns the items the given access level can see.
+func (m *Menu) Visible(level int) []Item {
+	var items []Item
+	for _, item := range m.Items {
+		if item.Level <= level {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,155 @@
+package messageboard
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"gbbs/internal/user"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type BoardConfig struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Order       int    `json:"order"`
+	ReadLevel   int    `json:"read_level"`
+	// PostLevel is left nil when not configured, so that guests can read
+	// but not post while an explicit 0 still lets them post.
+	PostLevel *int `json:"post_level,omitempty"`
+	// Path is a flat-file board from before messages moved into the
+	// database. It is imported once and then left alone.
+	Path string `json:"path,omitempty"`
+}
+
+type Board struct {
+	BoardConfig
+	db *sql.DB
+}
+
+func (b *Board) CanRead(level int) bool {
+	return level >= b.ReadLevel
+}
+
+func (b *Board) CanPost(level int) bool {
+	postLevel := user.LevelUser
+	if b.PostLevel != nil {
+		postLevel = *b.PostLevel
+	}
+	return b.CanRead(level) && level >= postLevel
+}
+
+// Manager holds the set of named boards, in display order.
+type Manager struct {
+	db     *sql.DB
+	boards []*Board
+	byName map[string]*Board
+}
+
+var validBoardName = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// NewManager opens the message database and the configured boards. Any
+// flat-file board found at the board's path, or at <legacyDir>/<name>.txt,
+// is imported the first time it is seen.
+func NewManager(dbPath string, configs []BoardConfig, legacyDir string) (*Manager, error) {
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("no message boards configured")
+	}
+
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := createTables(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := createLastReadTable(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	m := &Manager{db: db, byName: make(map[string]*Board)}
+	for _, cfg := range configs {
+		if !validBoardName.MatchString(cfg.Name) {
+			db.Close()
+			return nil, fmt.Errorf("invalid board name %q", cfg.Name)
+		}
+		if _, ok := m.byName[cfg.Name]; ok {
+			db.Close()
+			return nil, fmt.Errorf("duplicate board %q", cfg.Name)
+		}
+		if cfg.Path == "" {
+			cfg.Path = filepath.Join(legacyDir, cfg.Name+".txt")
+		}
+
+		board := &Board{BoardConfig: cfg, db: db}
+		if err := importLegacy(db, board.Name, cfg.Path); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("board %s: importing %s: %v", cfg.Name, cfg.Path, err)
+		}
+		m.boards = append(m.boards, board)
+		m.byName[cfg.Name] = board
+	}
+
+	sort.SliceStable(m.boards, func(i, j int) bool {
+		return m.boards[i].Order < m.boards[j].Order
+	})
+	return m, nil
+}
+
+func createTables(db *sql.DB) error {
+	_, err := db.Exec(`
+        CREATE TABLE IF NOT EXISTS messages (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            board TEXT NOT NULL,
+            parent_id INTEGER REFERENCES messages(id),
+            thread_id INTEGER,
+            subject TEXT NOT NULL DEFAULT '',
+            author TEXT NOT NULL,
+            body TEXT NOT NULL,
+            posted_at DATETIME NOT NULL
+        );
+        CREATE INDEX IF NOT EXISTS idx_messages_board_posted ON messages (board, posted_at);
+        CREATE INDEX IF NOT EXISTS idx_messages_thread ON messages (thread_id, id);
+        CREATE TABLE IF NOT EXISTS message_imports (
+            path TEXT PRIMARY KEY,
+            board TEXT NOT NULL,
+            messages INTEGER NOT NULL,
+            imported_at DATETIME DEFAULT CURRENT_TIMESTAMP
+        );
+    `)
+	return err
+}
+
+func (m *Manager) Close() error {
+	return m.db.Close()
+}
+
+func (m *Manager) Get(name string) *Board {
+	return m.byName[name]
+}
+
+// List returns the boards the given access level may read.
+func (m *Manager) List(level int) []*Board {
+	var boards []*Board
+	for _, b := range m.boards {
+		if b.CanRead(level) {
+			boards = append(boards, b)
+		}
+	}
+	return boards
+}
+
+// Default returns the first board the given access level may read.
+func (m *Manager) Default(level int) *Board {
+	boards := m.List(level)
+	if len(boards) == 0 {
+		return nil
+	}
+	return boards[0]
+}
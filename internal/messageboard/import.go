@@ -0,0 +1,108 @@
+package messageboard
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// importLegacy copies a flat-file board into the database the first time it
+// is seen. The file itself is left in place.
+func importLegacy(db *sql.DB, board, path string) error {
+	var imported string
+	err := db.QueryRow("SELECT path FROM message_imports WHERE path = ?", path).Scan(&imported)
+	if err == nil {
+		return nil
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	messages, err := readLegacyFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Message numbers in the file become fresh database IDs, so replies
+	// are re-pointed at their parent's new ID as we go.
+	ids := make(map[int64]int64)
+	for _, msg := range messages {
+		oldID := msg.ID
+		msg.Board = board
+		msg.ParentID = ids[msg.ParentID]
+		if err := insertMessage(tx, &msg); err != nil {
+			return err
+		}
+		ids[oldID] = msg.ID
+	}
+
+	if _, err := tx.Exec("INSERT INTO message_imports (path, board, messages) VALUES (?, ?, ?)", path, board, len(messages)); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("Imported %d messages from %s into board %s", len(messages), path, board)
+	return nil
+}
+
+func readLegacyFile(path string) ([]Message, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var messages []Message
+	scanner := bufio.NewScanner(file)
+	for lineNo := int64(1); scanner.Scan(); lineNo++ {
+		if msg, ok := parseLine(scanner.Text(), lineNo); ok {
+			messages = append(messages, msg)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+var legacyLine = regexp.MustCompile(`^\[(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2})\] ([^:]*): (.*)$`)
+
+// parseLine decodes one line of a flat-file board: either a JSON message or,
+// from the original guestbook format, "[time] user: text", which becomes a
+// subject-less message numbered by its line.
+func parseLine(line string, lineNo int64) (Message, bool) {
+	if strings.TrimSpace(line) == "" {
+		return Message{}, false
+	}
+
+	var msg Message
+	if strings.HasPrefix(line, "{") && json.Unmarshal([]byte(line), &msg) == nil {
+		return msg, true
+	}
+
+	msg = Message{ID: lineNo, Body: line}
+	if m := legacyLine.FindStringSubmatch(line); m != nil {
+		msg.Posted, _ = time.ParseInLocation("2006-01-02 15:04:05", m[1], time.Local)
+		msg.Author = m[2]
+		msg.Body = m[3]
+	}
+	return msg, true
+}
@@ -0,0 +1,112 @@
+package messageboard
+
+import "database/sql"
+
+func createLastReadTable(db *sql.DB) error {
+	_, err := db.Exec(`
+        CREATE TABLE IF NOT EXISTS last_read (
+            username TEXT NOT NULL,
+            board TEXT NOT NULL,
+            message_id INTEGER NOT NULL,
+            PRIMARY KEY (username, board)
+        )
+    `)
+	return err
+}
+
+// LastRead returns the ID of the newest message the user has read on the
+// board, or zero.
+func (b *Board) LastRead(username string) (int64, error) {
+	var id int64
+	err := b.db.QueryRow("SELECT message_id FROM last_read WHERE username = ? AND board = ?", username, b.Name).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
+// MarkRead moves the user's last-read pointer forward to id. It never moves
+// backwards.
+func (b *Board) MarkRead(username string, id int64) error {
+	_, err := b.db.Exec(`
+        INSERT INTO last_read (username, board, message_id) VALUES (?, ?, ?)
+        ON CONFLICT (username, board) DO UPDATE SET message_id = MAX(message_id, excluded.message_id)
+    `, username, b.Name, id)
+	return err
+}
+
+// MarkThreadRead advances the pointer past a thread the user has just read,
+// but stops short of any older unread message in another thread so that
+// message still shows up as new.
+func (b *Board) MarkThreadRead(username string, id int64) error {
+	last, err := b.LastRead(username)
+	if err != nil {
+		return err
+	}
+
+	var threadMax sql.NullInt64
+	err = b.db.QueryRow(`
+        SELECT MAX(id) FROM messages
+        WHERE board = ? AND thread_id = (SELECT thread_id FROM messages WHERE id = ?)
+    `, b.Name, id).Scan(&threadMax)
+	if err != nil {
+		return err
+	}
+	if !threadMax.Valid {
+		return ErrMessageNotFound
+	}
+
+	var firstOther sql.NullInt64
+	err = b.db.QueryRow(`
+        SELECT MIN(id) FROM messages
+        WHERE board = ? AND id > ? AND author != ?
+            AND thread_id != (SELECT thread_id FROM messages WHERE id = ?)
+    `, b.Name, last, username, id).Scan(&firstOther)
+	if err != nil {
+		return err
+	}
+
+	upTo := threadMax.Int64
+	if firstOther.Valid && firstOther.Int64-1 < upTo {
+		upTo = firstOther.Int64 - 1
+	}
+	if upTo <= last {
+		return nil
+	}
+	return b.MarkRead(username, upTo)
+}
+
+// NewMessages returns the messages posted by others since the user's
+// last-read pointer, oldest first.
+func (b *Board) NewMessages(username string) ([]Message, error) {
+	return queryMessages(b.db, `
+        SELECT `+messageColumns+` FROM messages
+        WHERE board = ? AND author != ?
+            AND id > COALESCE((SELECT message_id FROM last_read WHERE username = ? AND board = ?), 0)
+        ORDER BY id
+    `, b.Name, username, username, b.Name)
+}
+
+func (b *Board) UnreadCount(username string) (int, error) {
+	var count int
+	err := b.db.QueryRow(`
+        SELECT COUNT(*) FROM messages
+        WHERE board = ? AND author != ?
+            AND id > COALESCE((SELECT message_id FROM last_read WHERE username = ? AND board = ?), 0)
+    `, b.Name, username, username, b.Name).Scan(&count)
+	return count, err
+}
+
+// UnreadCounts returns the number of unread messages on every board the
+// access level may read, keyed by board name.
+func (m *Manager) UnreadCounts(username string, level int) (map[string]int, error) {
+	counts := make(map[string]int)
+	for _, b := range m.List(level) {
+		count, err := b.UnreadCount(username)
+		if err != nil {
+			return nil, err
+		}
+		counts[b.Name] = count
+	}
+	return counts, nil
+}
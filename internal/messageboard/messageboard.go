@@ -1,68 +1,245 @@
 package messageboard
 
 import (
-	"bufio"
+	"database/sql"
 	"fmt"
-	"os"
-	"sync"
+	"strings"
 	"time"
 )
 
-type MessageBoard struct {
-	filePath string
-	mu       sync.Mutex
+const (
+	maxSubjectLength = 80
+	maxBodyLength    = 16000
+)
+
+var ErrMessageNotFound = fmt.Errorf("message not found")
+
+type Message struct {
+	ID       int64     `json:"id"`
+	Board    string    `json:"board"`
+	ParentID int64     `json:"parent_id,omitempty"`
+	Subject  string    `json:"subject"`
+	Author   string    `json:"author"`
+	Body     string    `json:"body"`
+	Posted   time.Time `json:"posted"`
+}
+
+const messageColumns = "id, board, COALESCE(parent_id, 0), subject, author, body, posted_at"
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanMessage(row scanner) (Message, error) {
+	var msg Message
+	err := row.Scan(&msg.ID, &msg.Board, &msg.ParentID, &msg.Subject, &msg.Author, &msg.Body, &msg.Posted)
+	return msg, err
 }
 
-func New(filePath string) (*MessageBoard, error) {
-	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+func queryMessages(db *sql.DB, query string, args ...interface{}) ([]Message, error) {
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
-	file.Close()
+	defer rows.Close()
 
-	return &MessageBoard{filePath: filePath}, nil
+	var messages []Message
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
 }
 
-func (mb *MessageBoard) PostMessage(username, message string) error {
-	if len(message) == 0 {
-		return fmt.Errorf("message cannot be empty")
+// PostMessage stores a new message. A non-zero parentID makes it a reply;
+// replies without a subject inherit the parent's.
+func (b *Board) PostMessage(author, subject, body string, parentID int64) (*Message, error) {
+	subject = strings.TrimSpace(subject)
+	if len(body) == 0 {
+		return nil, fmt.Errorf("message cannot be empty")
+	}
+	if len(body) > maxBodyLength {
+		return nil, fmt.Errorf("message too long (max %d characters)", maxBodyLength)
+	}
+	if len(subject) > maxSubjectLength {
+		return nil, fmt.Errorf("subject too long (max %d characters)", maxSubjectLength)
+	}
+	if subject == "" && parentID == 0 {
+		return nil, fmt.Errorf("subject cannot be empty")
+	}
+
+	msg := &Message{
+		Board:    b.Name,
+		ParentID: parentID,
+		Subject:  subject,
+		Author:   author,
+		Body:     body,
+		Posted:   time.Now(),
+	}
+
+	tx, err := b.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := insertMessage(tx, msg); err != nil {
+		return nil, err
 	}
-	if len(message) > 500 {
-		return fmt.Errorf("message too long (max 500 characters)")
+	if err := tx.Commit(); err != nil {
+		return nil, err
 	}
+	return msg, nil
+}
 
-	mb.mu.Lock()
-	defer mb.mu.Unlock()
+// insertMessage stores msg and fills in its ID. Replies must point at a
+// message on the same board and join that message's thread.
+func insertMessage(tx *sql.Tx, msg *Message) error {
+	var parent, threadID interface{}
+	if msg.ParentID != 0 {
+		var parentSubject string
+		var thread int64
+		err := tx.QueryRow("SELECT subject, thread_id FROM messages WHERE id = ? AND board = ?",
+			msg.ParentID, msg.Board).Scan(&parentSubject, &thread)
+		if err == sql.ErrNoRows {
+			return ErrMessageNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Subject == "" {
+			msg.Subject = ReplySubject(parentSubject, maxSubjectLength)
+		}
+		parent, threadID = msg.ParentID, thread
+	}
 
-	file, err := os.OpenFile(mb.filePath, os.O_APPEND|os.O_WRONLY, 0644)
+	result, err := tx.Exec("INSERT INTO messages (board, parent_id, thread_id, subject, author, body, posted_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		msg.Board, parent, threadID, msg.Subject, msg.Author, msg.Body, msg.Posted)
+	if err != nil {
+		return err
+	}
+	msg.ID, err = result.LastInsertId()
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
-	_, err = file.WriteString(fmt.Sprintf("[%s] %s: %s\n", time.Now().Format("2006-01-02 15:04:05"), username, message))
+	if msg.ParentID == 0 {
+		_, err = tx.Exec("UPDATE messages SET thread_id = id WHERE id = ?", msg.ID)
+	}
 	return err
 }
 
-func (mb *MessageBoard) GetMessages() ([]string, error) {
-	mb.mu.Lock()
-	defer mb.mu.Unlock()
+func (b *Board) GetMessages() ([]Message, error) {
+	return queryMessages(b.db, "SELECT "+messageColumns+" FROM messages WHERE board = ? ORDER BY posted_at, id", b.Name)
+}
 
-	file, err := os.Open(mb.filePath)
+func (b *Board) GetMessage(id int64) (*Message, error) {
+	msg, err := scanMessage(b.db.QueryRow("SELECT "+messageColumns+" FROM messages WHERE id = ? AND board = ?", id, b.Name))
+	if err == sql.ErrNoRows {
+		return nil, ErrMessageNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
+	return &msg, nil
+}
 
-	var messages []string
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		messages = append(messages, scanner.Text())
+// DeleteMessage removes a message and keeps its replies in the thread:
+// they move up to its parent, or if it started the thread, the first reply
+// becomes the new thread root.
+func (b *Board) DeleteMessage(id int64) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var parentID sql.NullInt64
+	var threadID int64
+	err = tx.QueryRow("SELECT parent_id, thread_id FROM messages WHERE id = ? AND board = ?", id, b.Name).Scan(&parentID, &threadID)
+	if err == sql.ErrNoRows {
+		return ErrMessageNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if parentID.Valid {
+		if _, err := tx.Exec("UPDATE messages SET parent_id = ? WHERE parent_id = ?", parentID.Int64, id); err != nil {
+			return err
+		}
+	} else if err := promoteFirstReply(tx, id, threadID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM messages WHERE id = ?", id); err != nil {
+		return err
 	}
+	return tx.Commit()
+}
 
-	if err := scanner.Err(); err != nil {
+// promoteFirstReply makes the earliest reply to a thread root the new root,
+// with the root's other replies under it.
+func promoteFirstReply(tx *sql.Tx, rootID, threadID int64) error {
+	var newRoot int64
+	if err := tx.QueryRow("SELECT COALESCE(MIN(id), 0) FROM messages WHERE parent_id = ?", rootID).Scan(&newRoot); err != nil {
+		return err
+	}
+	if newRoot == 0 {
+		return nil
+	}
+
+	if _, err := tx.Exec("UPDATE messages SET parent_id = NULL WHERE id = ?", newRoot); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE messages SET parent_id = ? WHERE parent_id = ?", newRoot, rootID); err != nil {
+		return err
+	}
+	_, err := tx.Exec("UPDATE messages SET thread_id = ? WHERE thread_id = ?", newRoot, threadID)
+	return err
+}
+
+// Thread returns the whole thread the message belongs to.
+func (b *Board) Thread(id int64) ([]ThreadEntry, error) {
+	messages, err := queryMessages(b.db, `
+        SELECT `+messageColumns+` FROM messages
+        WHERE board = ? AND thread_id = (SELECT thread_id FROM messages WHERE id = ?)
+        ORDER BY id
+    `, b.Name, id)
+	if err != nil {
 		return nil, err
 	}
+	return buildThread(messages, id)
+}
 
-	return messages, nil
+// Threads lists every thread on the board, ordered by its most recent post.
+func (b *Board) Threads() ([]ThreadSummary, error) {
+	rows, err := b.db.Query(`
+        SELECT r.id, r.board, 0, r.subject, r.author, r.body, r.posted_at,
+            (SELECT COUNT(*) - 1 FROM messages c WHERE c.thread_id = r.id),
+            l.id, l.posted_at
+        FROM messages r
+        JOIN messages l ON l.id = (SELECT MAX(id) FROM messages WHERE thread_id = r.id)
+        WHERE r.board = ? AND r.parent_id IS NULL
+        ORDER BY l.id
+    `, b.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var summaries []ThreadSummary
+	for rows.Next() {
+		var t ThreadSummary
+		root := &t.Root
+		if err := rows.Scan(&root.ID, &root.Board, &root.ParentID, &root.Subject, &root.Author, &root.Body, &root.Posted,
+			&t.Replies, &t.LastID, &t.LastPost); err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, t)
+	}
+	return summaries, rows.Err()
 }
@@ -0,0 +1,67 @@
+package messageboard
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+type ThreadEntry struct {
+	Message
+	Depth int `json:"depth"`
+}
+
+type ThreadSummary struct {
+	Root     Message   `json:"root"`
+	Replies  int       `json:"replies"`
+	LastID   int64     `json:"last_id"`
+	LastPost time.Time `json:"last_post"`
+}
+
+// ReplySubject prefixes subject with "Re: " unless it already has one,
+// shortened on a rune boundary to at most max bytes. Board replies and mail
+// replies share it.
+func ReplySubject(subject string, max int) string {
+	if subject != "" && !strings.HasPrefix(strings.ToLower(subject), "re: ") {
+		subject = "Re: " + subject
+	}
+	for len(subject) > max {
+		_, size := utf8.DecodeLastRuneInString(subject)
+		subject = subject[:len(subject)-size]
+	}
+	return subject
+}
+
+// buildThread arranges the messages of one thread root first, with replies
+// depth-first in posting order. id must be one of the messages.
+func buildThread(messages []Message, id int64) ([]ThreadEntry, error) {
+	found := false
+	children := make(map[int64][]Message)
+	var roots []Message
+	for _, m := range messages {
+		if m.ID == id {
+			found = true
+		}
+		if m.ParentID == 0 {
+			roots = append(roots, m)
+		} else {
+			children[m.ParentID] = append(children[m.ParentID], m)
+		}
+	}
+	if !found || len(roots) == 0 {
+		return nil, ErrMessageNotFound
+	}
+
+	var entries []ThreadEntry
+	var walk func(m Message, depth int)
+	walk = func(m Message, depth int) {
+		entries = append(entries, ThreadEntry{Message: m, Depth: depth})
+		for _, child := range children[m.ID] {
+			walk(child, depth+1)
+		}
+	}
+	for _, root := range roots {
+		walk(root, 0)
+	}
+	return entries, nil
+}
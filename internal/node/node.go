@@ -0,0 +1,260 @@
+package node
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrNoSuchNode = errors.New("no such node")
+
+// inboxSize is how many undelivered messages a node holds before further
+// ones are dropped.
+const inboxSize = 32
+
+// Message kinds delivered to nodes.
+const (
+	KindPage   = "page"
+	KindChat   = "chat"
+	KindSystem = "system"
+	// KindShutdown warns that the BBS is going down. Sessions show it even
+	// when they are holding other messages back.
+	KindShutdown = "shutdown"
+)
+
+// Message is delivered asynchronously to whoever is on a node: a page from
+// another user, a teleconference line, or a notice from the system.
+type Message struct {
+	Kind string    `json:"kind"`
+	From string    `json:"from,omitempty"`
+	Text string    `json:"text"`
+	Time time.Time `json:"time"`
+}
+
+// Node is one connection to the BBS. Nodes are numbered from 1, and a number
+// is reused once its connection ends.
+type Node struct {
+	Number     int
+	Protocol   string
+	RemoteAddr string
+	Since      time.Time
+
+	disconnect func()
+	inbox      chan Message
+
+	mu       sync.Mutex
+	username string
+	activity string
+}
+
+// Deliver queues a message for the node without blocking. It reports false
+// if the node's inbox is full and the message was dropped.
+func (n *Node) Deliver(msg Message) bool {
+	if msg.Time.IsZero() {
+		msg.Time = time.Now()
+	}
+	select {
+	case n.inbox <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// Messages returns the channel delivered messages arrive on. Only the
+// session running on the node should read from it.
+func (n *Node) Messages() <-chan Message {
+	return n.inbox
+}
+
+// Pending returns and clears the messages waiting on the node, for
+// sessions that poll instead of reading Messages.
+func (n *Node) Pending() []Message {
+	messages := []Message{}
+	for {
+		select {
+		case msg := <-n.inbox:
+			messages = append(messages, msg)
+		default:
+			return messages
+		}
+	}
+}
+
+// Info is a snapshot of a node for listings.
+type Info struct {
+	Number     int       `json:"node"`
+	Username   string    `json:"username"`
+	Protocol   string    `json:"protocol"`
+	RemoteAddr string    `json:"remote_addr,omitempty"`
+	Activity   string    `json:"activity"`
+	Since      time.Time `json:"since"`
+}
+
+// SetUser records who logged in on the node.
+func (n *Node) SetUser(username string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.username = username
+}
+
+func (n *Node) Username() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.username
+}
+
+// SetActivity records what the user on the node is doing, for who's online.
+func (n *Node) SetActivity(activity string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.activity = activity
+}
+
+func (n *Node) Info() Info {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return Info{
+		Number:     n.Number,
+		Username:   n.username,
+		Protocol:   n.Protocol,
+		RemoteAddr: n.RemoteAddr,
+		Activity:   n.activity,
+		Since:      n.Since,
+	}
+}
+
+// Registry tracks every node connected to the BBS.
+type Registry struct {
+	mu    sync.Mutex
+	nodes map[int]*Node
+}
+
+func NewRegistry() *Registry {
+	return &Registry{nodes: make(map[int]*Node)}
+}
+
+// Add registers a connection on the lowest free node number. disconnect is
+// called to drop the connection when a sysop asks for it.
+func (r *Registry) Add(protocol, remoteAddr string, disconnect func()) *Node {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := &Node{
+		Number:     1,
+		Protocol:   protocol,
+		RemoteAddr: remoteAddr,
+		Since:      time.Now(),
+		disconnect: disconnect,
+		inbox:      make(chan Message, inboxSize),
+		activity:   "Logging in",
+	}
+	for r.nodes[n.Number] != nil {
+		n.Number++
+	}
+	r.nodes[n.Number] = n
+	return n
+}
+
+func (r *Registry) Remove(n *Node) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.nodes[n.Number] == n {
+		delete(r.nodes, n.Number)
+	}
+}
+
+func (r *Registry) Get(number int) *Node {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.nodes[number]
+}
+
+// List returns a snapshot of every node, ordered by number.
+func (r *Registry) List() []Info {
+	r.mu.Lock()
+	nodes := make([]*Node, 0, len(r.nodes))
+	for _, n := range r.nodes {
+		nodes = append(nodes, n)
+	}
+	r.mu.Unlock()
+
+	list := make([]Info, len(nodes))
+	for i, n := range nodes {
+		list[i] = n.Info()
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Number < list[j].Number })
+	return list
+}
+
+// Disconnect drops the connection on a node. The node disappears from the
+// registry once its session has ended.
+func (r *Registry) Disconnect(number int) error {
+	n := r.Get(number)
+	if n == nil {
+		return ErrNoSuchNode
+	}
+	n.disconnect()
+	return nil
+}
+
+// FindUser returns the nodes the user is logged in on.
+func (r *Registry) FindUser(username string) []*Node {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var nodes []*Node
+	for _, n := range r.nodes {
+		if n.Username() == username {
+			nodes = append(nodes, n)
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Number < nodes[j].Number })
+	return nodes
+}
+
+// Page delivers a message to every node the user is logged in on, and
+// returns how many received it.
+func (r *Registry) Page(username string, msg Message) int {
+	count := 0
+	for _, n := range r.FindUser(username) {
+		if n.Deliver(msg) {
+			count++
+		}
+	}
+	return count
+}
+
+// Broadcast delivers a message to every node.
+func (r *Registry) Broadcast(msg Message) {
+	r.mu.Lock()
+	nodes := make([]*Node, 0, len(r.nodes))
+	for _, n := range r.nodes {
+		nodes = append(nodes, n)
+	}
+	r.mu.Unlock()
+
+	for _, n := range nodes {
+		n.Deliver(msg)
+	}
+}
+
+// DisconnectAll drops every node.
+func (r *Registry) DisconnectAll() {
+	for _, info := range r.List() {
+		r.Disconnect(info.Number)
+	}
+}
+
+// DisconnectUser drops every node the user is logged in on and returns how
+// many there were.
+func (r *Registry) DisconnectUser(username string) int {
+	count := 0
+	for _, info := range r.List() {
+		if info.Username == username && r.Disconnect(info.Number) == nil {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,61 @@
+package session
+
+import (
+	"strconv"
+	"strings"
+)
+
+func (s *Session) manageSSHKeys() {
+	for {
+		keys, err := s.svc.Users.AuthorizedKeys(s.username)
+		if err != nil {
+			s.printf("\033[0;31mError reading SSH keys: %v\033[0m\n", err)
+			return
+		}
+
+		s.printf("\n\033[0;36mSSH keys for %s:\033[0m\n", s.username)
+		if len(keys) == 0 {
+			s.printf("No keys registered.\n")
+		}
+		for i, key := range keys {
+			s.printf("%d. %s %s %s\n", i+1, key.Type, key.Fingerprint, key.Comment)
+		}
+
+		choice, err := s.term.ReadLine("(A)dd key, (D)elete key, (Q)uit: ")
+		if err != nil {
+			return
+		}
+
+		switch strings.ToLower(strings.TrimSpace(choice)) {
+		case "a":
+			line, err := s.term.ReadLine("Paste your public key (authorized_keys format): ")
+			if err != nil {
+				return
+			}
+			if err := s.svc.Users.AddAuthorizedKey(s.username, line); err != nil {
+				s.printf("\033[0;31mError adding key: %v\033[0m\n", err)
+			} else {
+				s.printf("\033[0;32mKey added. You can now log in over SSH as %s without a password.\033[0m\n", s.username)
+			}
+		case "d":
+			input, err := s.term.ReadLine("Key number to delete: ")
+			if err != nil {
+				return
+			}
+			n, err := strconv.Atoi(strings.TrimSpace(input))
+			if err != nil || n < 1 || n > len(keys) {
+				s.printf("\033[0;31mInvalid key number.\033[0m\n")
+				continue
+			}
+			if err := s.svc.Users.RemoveAuthorizedKey(s.username, keys[n-1].Fingerprint); err != nil {
+				s.printf("\033[0;31mError deleting key: %v\033[0m\n", err)
+			} else {
+				s.printf("\033[0;32mKey deleted.\033[0m\n")
+			}
+		case "q", "":
+			return
+		default:
+			s.printf("\033[0;31mInvalid choice. Please try again.\033[0m\n")
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package session
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gbbs/internal/messageboard"
+	"gbbs/internal/user"
+)
+
+// requireSysop guards sysop actions in case a menu file exposes them to
+// lower levels.
+func (s *Session) requireSysop() bool {
+	if s.level < user.LevelSysop {
+		s.printf("\033[0;31mThat is for sysops only.\033[0m\n")
+		return false
+	}
+	return true
+}
+
+func (s *Session) adminUsers() {
+	if !s.requireSysop() {
+		return
+	}
+
+	for {
+		search, err := s.term.ReadLine("Search users (Enter for all, Q to quit): ")
+		if err != nil {
+			return
+		}
+		search = strings.TrimSpace(search)
+		if strings.EqualFold(search, "q") {
+			return
+		}
+
+		users, err := s.svc.Users.ListUsers(search)
+		if err != nil {
+			s.printf("\033[0;31mError listing users: %v\033[0m\n", err)
+			return
+		}
+		if len(users) == 0 {
+			s.printf("No matching users.\n")
+			continue
+		}
+
+		lines := []string{fmt.Sprintf("%4s  %-20s %-10s %s", "#", "Username", "Role", "Status")}
+		for i, u := range users {
+			lines = append(lines, fmt.Sprintf("%4d  %-20s %-10s %s", i+1, u.Username, u.Role, userStatus(u)))
+		}
+		s.page(lines)
+
+		input, err := s.term.ReadLine("User # to manage (Enter to search again): ")
+		if err != nil {
+			return
+		}
+		input = strings.TrimSpace(input)
+		if input == "" {
+			continue
+		}
+		n, err := strconv.Atoi(input)
+		if err != nil || n < 1 || n > len(users) {
+			s.printf("\033[0;31mInvalid user number.\033[0m\n")
+			continue
+		}
+		if !s.adminUser(users[n-1]) {
+			return
+		}
+	}
+}
+
+func userStatus(u user.Info) string {
+	if u.Banned {
+		return "\033[0;31mbanned\033[0m"
+	}
+	return "active"
+}
+
+// adminUser lets the sysop change one account. It returns false if the
+// connection dropped.
+func (s *Session) adminUser(u user.Info) bool {
+	for {
+		s.printf("\n\033[0;36m%s\033[0m  role: %s  status: %s\n", u.Username, u.Role, userStatus(u))
+		choice, err := s.term.ReadLine("(P)assword reset, (R)ole, (B)an/unban, (D)elete, (Q)uit: ")
+		if err != nil {
+			return false
+		}
+		choice = strings.ToLower(strings.TrimSpace(choice))
+
+		if choice != "p" && choice != "q" && choice != "" && u.Username == s.username {
+			s.printf("\033[0;31mYou cannot change your own role or ban or delete yourself.\033[0m\n")
+			continue
+		}
+
+		switch choice {
+		case "p":
+			password, err := s.term.ReadPassword(fmt.Sprintf("New password for %s: ", u.Username))
+			if err != nil {
+				return false
+			}
+			if err := s.svc.Users.SetPassword(u.Username, password); err != nil {
+				s.printf("\033[0;31mError setting password: %v\033[0m\n", err)
+			} else {
+				s.printf("\033[0;32mPassword changed.\033[0m\n")
+			}
+		case "r":
+			role, err := s.term.ReadLine(fmt.Sprintf("New role (%s): ", strings.Join(user.Roles, ", ")))
+			if err != nil {
+				return false
+			}
+			role = strings.ToLower(strings.TrimSpace(role))
+			if err := s.svc.Users.SetRole(u.Username, role); err != nil {
+				s.printf("\033[0;31mError setting role: %v\033[0m\n", err)
+			} else {
+				u.Role = role
+				s.printf("\033[0;32m%s is now %s.\033[0m\n", u.Username, role)
+			}
+		case "b":
+			if err := s.svc.Users.SetBanned(u.Username, !u.Banned); err != nil {
+				s.printf("\033[0;31mError changing ban: %v\033[0m\n", err)
+				continue
+			}
+			u.Banned = !u.Banned
+			s.printf("\033[0;32m%s is now %s.\033[0m\n", u.Username, userStatus(u))
+			if u.Banned {
+				s.kickUser(u.Username)
+			}
+		case "d":
+			if !s.confirm(fmt.Sprintf("Delete %s permanently? [y/N] ", u.Username)) {
+				continue
+			}
+			if err := s.svc.Users.DeleteUser(u.Username); err != nil {
+				s.printf("\033[0;31mError deleting user: %v\033[0m\n", err)
+				continue
+			}
+			s.printf("\033[0;32m%s deleted.\033[0m\n", u.Username)
+			s.kickUser(u.Username)
+			return true
+		case "q", "":
+			return true
+		default:
+			s.printf("\033[0;31mInvalid choice. Please try again.\033[0m\n")
+		}
+	}
+}
+
+// confirm asks a yes/no question that defaults to no.
+func (s *Session) confirm(prompt string) bool {
+	key, err := s.readKey(prompt)
+	s.printf("\n")
+	return err == nil && (key == 'y' || key == 'Y')
+}
+
+func (s *Session) adminDeleteMessage() {
+	if !s.requireSysop() {
+		return
+	}
+
+	input, err := s.term.ReadLine("Message # to delete: ")
+	if err != nil {
+		return
+	}
+	id, err := strconv.ParseInt(strings.TrimSpace(input), 10, 64)
+	if err != nil {
+		s.printf("\033[0;31mInvalid message number.\033[0m\n")
+		return
+	}
+
+	for _, board := range s.svc.Boards.List(s.level) {
+		msg, err := board.GetMessage(id)
+		if err == messageboard.ErrMessageNotFound {
+			continue
+		}
+		if err != nil {
+			s.printf("\033[0;31mError reading message: %v\033[0m\n", err)
+			return
+		}
+		s.deleteMessage(board, msg)
+		return
+	}
+	s.printf("\033[0;31mNo message #%d.\033[0m\n", id)
+}
+
+// deleteMessage shows a message and deletes it once confirmed. It reports
+// whether the message was deleted.
+func (s *Session) deleteMessage(board *messageboard.Board, msg *messageboard.Message) bool {
+	width, _ := s.termSize()
+	for _, line := range formatMessage(messageboard.ThreadEntry{Message: *msg}, width) {
+		s.printf("%s\n", line)
+	}
+	if !s.confirm(fmt.Sprintf("Delete message #%d from %s? [y/N] ", msg.ID, board.Name)) {
+		return false
+	}
+	if err := board.DeleteMessage(msg.ID); err != nil {
+		s.printf("\033[0;31mError deleting message: %v\033[0m\n", err)
+		return false
+	}
+	s.printf("\033[0;32mMessage #%d deleted.\033[0m\n", msg.ID)
+	return true
+}
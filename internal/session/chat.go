@@ -0,0 +1,176 @@
+package session
+
+import (
+	"fmt"
+	"strings"
+
+	"gbbs/internal/node"
+	"gbbs/internal/user"
+)
+
+// receiveMessages shows pages and teleconference lines as they arrive on
+// the session's node, until the returned stop function is called.
+func (s *Session) receiveMessages() (stop func()) {
+	quit := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case msg := <-s.node.Messages():
+				s.receive(msg)
+			case <-quit:
+				return
+			}
+		}
+	}()
+	return func() { close(quit) }
+}
+
+func (s *Session) receive(msg node.Message) {
+	s.mu.Lock()
+	if msg.Kind == node.KindPage {
+		s.lastPager = msg.From
+	}
+	if s.hold > 0 && msg.Kind != node.KindShutdown {
+		s.held = append(s.held, msg)
+		s.mu.Unlock()
+		return
+	}
+	s.mu.Unlock()
+
+	// The console redraws any prompt the user is typing at
+	s.printf("%s\n", formatNodeMessage(msg))
+}
+
+// holdMessages keeps incoming messages from being written while something
+// owns the whole screen, such as the editor or the pager. The returned
+// function shows what arrived in the meantime.
+func (s *Session) holdMessages() (release func()) {
+	s.mu.Lock()
+	s.hold++
+	s.mu.Unlock()
+
+	return func() {
+		s.mu.Lock()
+		s.hold--
+		var held []node.Message
+		if s.hold == 0 {
+			held, s.held = s.held, nil
+		}
+		s.mu.Unlock()
+
+		for _, msg := range held {
+			s.printf("%s\n", formatNodeMessage(msg))
+		}
+	}
+}
+
+func formatNodeMessage(msg node.Message) string {
+	switch msg.Kind {
+	case node.KindPage:
+		return fmt.Sprintf("\033[1;35m*** Page from %s at %s: %s\033[0m", msg.From, msg.Time.Format("15:04"), msg.Text)
+	case node.KindChat:
+		return fmt.Sprintf("\033[0;32m<%s>\033[0m %s", msg.From, msg.Text)
+	case node.KindShutdown:
+		return fmt.Sprintf("\a\033[1;31m*** %s\033[0m", msg.Text)
+	default:
+		return fmt.Sprintf("\033[0;33m*** %s\033[0m", msg.Text)
+	}
+}
+
+func (s *Session) pageUser() {
+	if s.level < user.LevelUser {
+		s.printf("\033[0;31mGuests cannot page other users.\033[0m\n")
+		return
+	}
+
+	s.mu.Lock()
+	last := s.lastPager
+	s.mu.Unlock()
+
+	prompt := "Page who? "
+	if last != "" {
+		prompt = fmt.Sprintf("Page who? [%s] ", last)
+	}
+	to, err := s.term.ReadLine(prompt)
+	if err != nil {
+		return
+	}
+	if to = strings.TrimSpace(to); to == "" {
+		to = last
+	}
+	if to == "" {
+		return
+	}
+
+	text, err := s.term.ReadLine("Message: ")
+	if err != nil {
+		return
+	}
+	s.sendPage(to, text)
+}
+
+// sendPage delivers an instant message to every node the user is on.
+func (s *Session) sendPage(to, text string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+	if to == s.username {
+		s.printf("\033[0;31mYou cannot page yourself.\033[0m\n")
+		return
+	}
+	if s.svc.Nodes.Page(to, node.Message{Kind: node.KindPage, From: s.username, Text: text}) == 0 {
+		s.printf("\033[0;31m%s is not online.\033[0m\n", to)
+		return
+	}
+	s.printf("\033[0;32mPage sent to %s.\033[0m\n", to)
+}
+
+// teleconference is the chat room shared by every node.
+func (s *Session) teleconference() {
+	room := s.svc.Chat
+
+	s.printf("\033[0;36mEntering teleconference. Commands: /who, /me <action>, /page <user> <message>, /quit\033[0m\n")
+	for _, line := range room.History(0) {
+		s.printf("%s\n", formatNodeMessage(line.Message))
+	}
+
+	room.Join(s.node)
+	defer room.Leave(s.node)
+	s.printf("\033[0;33m*** In the room: %s\033[0m\n", strings.Join(room.Members(), ", "))
+
+	for {
+		input, err := s.term.ReadLine("> ")
+		if err != nil {
+			return
+		}
+		input = strings.TrimSpace(input)
+		if input == "" {
+			continue
+		}
+
+		fields := strings.Fields(input)
+		switch strings.ToLower(fields[0]) {
+		case "/quit", "/q":
+			return
+		case "/who":
+			s.printf("\033[0;33m*** In the room: %s\033[0m\n", strings.Join(room.Members(), ", "))
+		case "/me":
+			if len(fields) > 1 {
+				room.Emote(s.username, strings.TrimSpace(strings.TrimPrefix(input, fields[0])))
+			}
+		case "/page", "/msg":
+			if len(fields) < 3 {
+				s.printf("\033[0;31mUsage: /page <user> <message>\033[0m\n")
+				continue
+			}
+			s.sendPage(fields[1], strings.Join(fields[2:], " "))
+		default:
+			if strings.HasPrefix(input, "/") {
+				s.printf("\033[0;31mUnknown command %s\033[0m\n", fields[0])
+				continue
+			}
+			room.Say(s.node, s.username, input)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"sync"
+)
+
+// Special keys returned by Console.ReadKey. They live in the surrogate range,
+// which never comes out of UTF-8 decoding, so they cannot collide with input.
+const (
+	KeyUnknown rune = 0xd800 + iota
+	KeyEscape
+	KeyUp
+	KeyDown
+	KeyLeft
+	KeyRight
+	KeyHome
+	KeyEnd
+	KeyInsert
+	KeyDelete
+	KeyPageUp
+	KeyPageDown
+)
+
+const (
+	keyCtrlD     = 0x04
+	keyBackspace = 0x08
+	keyCtrlU     = 0x15
+	keyCtrlW     = 0x17
+	keyDelete    = 0x7f
+
+	maxLineLength = 4096
+)
+
+// Console implements Terminal on top of a raw, character-at-a-time byte
+// stream. It does its own echo and line editing so every transport that
+// feeds it behaves the same, and it redraws the line being edited when
+// output arrives from another goroutine.
+type Console struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	mu        sync.Mutex
+	prompt    string
+	line      []rune
+	mask      bool
+	editing   bool
+	localEcho bool
+	lastCR    bool
+}
+
+func NewConsole(r io.Reader, w io.Writer) *Console {
+	return &Console{in: bufio.NewReader(r), out: w}
+}
+
+// SetLocalEcho tells the console that the client echoes its own input (for
+// example a telnet client that refused to let the server echo), so the
+// console must stay silent while reading.
+func (c *Console) SetLocalEcho(on bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.localEcho = on
+}
+
+func (c *Console) LocalEcho() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.localEcho
+}
+
+func (c *Console) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.editing {
+		c.writeLocked([]byte("\r\033[K"))
+	}
+	err := c.writeLocked(p)
+	if c.editing {
+		c.redrawLocked()
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writeLocked converts bare newlines to CRLF, which raw terminals need.
+func (c *Console) writeLocked(p []byte) error {
+	var buf bytes.Buffer
+	for i, b := range p {
+		if b == '\n' && (i == 0 || p[i-1] != '\r') {
+			buf.WriteByte('\r')
+		}
+		buf.WriteByte(b)
+	}
+	_, err := c.out.Write(buf.Bytes())
+	return err
+}
+
+func (c *Console) redrawLocked() {
+	c.writeLocked([]byte(c.prompt))
+	if !c.mask && !c.localEcho {
+		c.writeLocked([]byte(string(c.line)))
+	}
+}
+
+func (c *Console) echoLocked(s string) {
+	if !c.localEcho {
+		c.writeLocked([]byte(s))
+	}
+}
+
+func (c *Console) ReadLine(prompt string) (string, error) {
+	return c.readLine(prompt, false)
+}
+
+func (c *Console) ReadPassword(prompt string) (string, error) {
+	return c.readLine(prompt, true)
+}
+
+func (c *Console) readLine(prompt string, mask bool) (string, error) {
+	c.mu.Lock()
+	c.prompt = prompt
+	c.line = c.line[:0]
+	c.mask = mask
+	c.editing = true
+	c.writeLocked([]byte(prompt))
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		c.editing = false
+		c.mu.Unlock()
+	}()
+
+	for {
+		key, err := c.readKey()
+		if err != nil {
+			return "", err
+		}
+
+		c.mu.Lock()
+		switch key {
+		case '\r', '\n':
+			line := string(c.line)
+			c.echoLocked("\r\n")
+			c.mu.Unlock()
+			return line, nil
+		case keyCtrlD:
+			if len(c.line) == 0 {
+				c.mu.Unlock()
+				return "", io.EOF
+			}
+		case keyBackspace, keyDelete:
+			c.eraseLocked(1)
+		case keyCtrlU:
+			c.eraseLocked(len(c.line))
+		case keyCtrlW:
+			n := len(c.line)
+			for n > 0 && c.line[n-1] == ' ' {
+				n--
+			}
+			for n > 0 && c.line[n-1] != ' ' {
+				n--
+			}
+			c.eraseLocked(len(c.line) - n)
+		default:
+			if key >= ' ' && key < KeyUnknown && len(c.line) < maxLineLength {
+				c.line = append(c.line, key)
+				if !c.mask {
+					c.echoLocked(string(key))
+				}
+			}
+		}
+		c.mu.Unlock()
+	}
+}
+
+func (c *Console) eraseLocked(n int) {
+	if n > len(c.line) {
+		n = len(c.line)
+	}
+	c.line = c.line[:len(c.line)-n]
+	if !c.mask {
+		for i := 0; i < n; i++ {
+			c.echoLocked("\b \b")
+		}
+	}
+}
+
+// ReadKey waits for a single keypress without echoing it. Clients that do
+// their own line editing only send whole lines, so for them the first
+// character of the line is returned instead.
+func (c *Console) ReadKey(prompt string) (rune, error) {
+	c.mu.Lock()
+	localEcho := c.localEcho
+	if prompt != "" {
+		c.writeLocked([]byte(prompt))
+	}
+	c.mu.Unlock()
+
+	if localEcho {
+		line, err := c.readLine("", false)
+		if err != nil {
+			return 0, err
+		}
+		if line == "" {
+			return '\r', nil
+		}
+		return []rune(line)[0], nil
+	}
+	return c.readKey()
+}
+
+func (c *Console) readKey() (rune, error) {
+	for {
+		r, _, err := c.in.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+
+		// Treat CR LF as a single Enter
+		if c.lastCR && r == '\n' {
+			c.lastCR = false
+			continue
+		}
+		c.lastCR = r == '\r'
+
+		if r == 0x1b {
+			return c.readEscape(), nil
+		}
+		return r, nil
+	}
+}
+
+// readEscape decodes the common VT100/xterm cursor key sequences. An escape
+// byte with nothing behind it in the buffer is a lone ESC keypress.
+func (c *Console) readEscape() rune {
+	if c.in.Buffered() == 0 {
+		return KeyEscape
+	}
+	b, _ := c.in.ReadByte()
+	if b != '[' && b != 'O' {
+		c.in.UnreadByte()
+		return KeyEscape
+	}
+
+	var params []byte
+	for c.in.Buffered() > 0 {
+		b, _ = c.in.ReadByte()
+		if b >= 0x40 && b <= 0x7e {
+			break
+		}
+		params = append(params, b)
+	}
+
+	switch b {
+	case 'A':
+		return KeyUp
+	case 'B':
+		return KeyDown
+	case 'C':
+		return KeyRight
+	case 'D':
+		return KeyLeft
+	case 'H':
+		return KeyHome
+	case 'F':
+		return KeyEnd
+	case '~':
+		switch string(params) {
+		case "1", "7":
+			return KeyHome
+		case "2":
+			return KeyInsert
+		case "3":
+			return KeyDelete
+		case "4", "8":
+			return KeyEnd
+		case "5":
+			return KeyPageUp
+		case "6":
+			return KeyPageDown
+		}
+	}
+	return KeyUnknown
+}
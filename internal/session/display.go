@@ -0,0 +1,112 @@
+package session
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	defaultWidth  = 80
+	defaultHeight = 24
+)
+
+// WindowTerminal is implemented by terminals that know the client's window
+// size and terminal type. The size can change while the session runs, so
+// callers should ask again before laying out each screen.
+type WindowTerminal interface {
+	Size() (width, height int)
+	TermType() string
+}
+
+// termSize returns the client's window size, falling back to 80x24 when the
+// transport does not know it.
+func (s *Session) termSize() (width, height int) {
+	width, height = defaultWidth, defaultHeight
+	if wt, ok := s.term.(WindowTerminal); ok {
+		if w, h := wt.Size(); w > 0 && h > 0 {
+			width, height = w, h
+		}
+	}
+	return width, height
+}
+
+func (s *Session) termType() string {
+	if wt, ok := s.term.(WindowTerminal); ok {
+		return wt.TermType()
+	}
+	return ""
+}
+
+// wrapText breaks text into lines no wider than width, splitting on spaces
+// where possible.
+func wrapText(text string, width int) []string {
+	if width < 1 {
+		width = 1
+	}
+
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			for utf8.RuneCountInString(word) > width {
+				if line != "" {
+					lines = append(lines, line)
+					line = ""
+				}
+				runes := []rune(word)
+				lines = append(lines, string(runes[:width]))
+				word = string(runes[width:])
+			}
+			switch {
+			case line == "":
+				line = word
+			case utf8.RuneCountInString(line)+1+utf8.RuneCountInString(word) <= width:
+				line += " " + word
+			default:
+				lines = append(lines, line)
+				line = word
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// page writes lines a screenful at a time. It returns false if the user
+// stopped early or the connection dropped.
+func (s *Session) page(lines []string) bool {
+	defer s.holdMessages()()
+
+	shown := 0
+	for _, line := range lines {
+		_, height := s.termSize()
+		if shown >= height-1 {
+			key, err := s.readKey("\033[0;33m-- More -- (Enter) more (Q)uit\033[0m")
+			s.printf("\r\033[K")
+			if err != nil || key == 'q' || key == 'Q' {
+				return false
+			}
+			shown = 0
+		}
+		s.printf("%s\n", line)
+		shown++
+	}
+	return true
+}
+
+// readKey reads a single keypress where the terminal supports it and a whole
+// line otherwise.
+func (s *Session) readKey(prompt string) (rune, error) {
+	if kr, ok := s.term.(KeyReader); ok {
+		return kr.ReadKey(prompt)
+	}
+	line, err := s.term.ReadLine(prompt)
+	if err != nil {
+		return 0, err
+	}
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return '\r', nil
+	}
+	return []rune(line)[0], nil
+}
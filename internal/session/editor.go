@@ -0,0 +1,378 @@
+package session
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	keyCtrlA = 0x01
+	keyCtrlC = 0x03
+	keyCtrlE = 0x05
+	keyCtrlN = 0x0e
+	keyCtrlQ = 0x11
+	keyCtrlY = 0x19
+	keyCtrlZ = 0x1a
+
+	maxEditorLines = 1000
+)
+
+// editorTerminal is implemented by consoles that can tell whether the client
+// is echoing its own input, in which case it is not in character mode and
+// cannot drive the full-screen editor.
+type editorTerminal interface {
+	LocalEcho() bool
+}
+
+// editText lets the user compose a multi-line text. Clients with an ANSI
+// terminal in character mode get the full-screen editor, everyone else a
+// line-at-a-time one. quote holds the lines inserted by the quote command.
+// It returns false if the user aborted.
+func (s *Session) editText(title string, quote []string) (string, bool) {
+	if s.canUseEditor() {
+		return s.fullScreenEdit(title, quote)
+	}
+	return s.lineEdit(quote)
+}
+
+func (s *Session) canUseEditor() bool {
+	if _, ok := s.term.(KeyReader); !ok {
+		return false
+	}
+	if et, ok := s.term.(editorTerminal); ok && et.LocalEcho() {
+		return false
+	}
+	termType := strings.ToLower(s.termType())
+	return termType != "" && termType != "dumb"
+}
+
+func (s *Session) lineEdit(quote []string) (string, bool) {
+	help := "Enter your message. Type /s on a line by itself to save, /a to abort"
+	if len(quote) > 0 {
+		help += ", /q to quote"
+	}
+	s.printf("%s.\n", help)
+
+	var lines []string
+	for {
+		line, err := s.term.ReadLine(fmt.Sprintf("%3d: ", len(lines)+1))
+		if err != nil {
+			return "", false
+		}
+
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "/s":
+			return strings.TrimRight(strings.Join(lines, "\n"), "\n "), true
+		case "/a":
+			return "", false
+		case "/q":
+			for _, q := range quote {
+				s.printf("%3d: %s\n", len(lines)+1, q)
+				lines = append(lines, q)
+			}
+		default:
+			if len(lines) < maxEditorLines {
+				lines = append(lines, line)
+			}
+		}
+	}
+}
+
+// editor is the state of the full-screen editor. The first screen row is a
+// title bar and the last a status line; the text fills the rows between.
+type editor struct {
+	s      *Session
+	title  string
+	quote  []string
+	lines  [][]rune
+	row    int
+	col    int
+	top    int
+	width  int
+	height int
+	status string
+}
+
+func (s *Session) fullScreenEdit(title string, quote []string) (string, bool) {
+	defer s.holdMessages()()
+
+	e := &editor{s: s, title: title, quote: quote, lines: [][]rune{{}}}
+	e.width, e.height = s.termSize()
+	e.render()
+
+	for {
+		key, err := s.readKey("")
+		if err != nil {
+			return "", false
+		}
+
+		full := e.resized()
+		e.status = ""
+
+		switch key {
+		case keyCtrlZ:
+			s.printf("\033[2J\033[H")
+			return e.text(), true
+		case keyCtrlC, KeyEscape:
+			if e.confirm("Abort this message? (y/N) ") {
+				s.printf("\033[2J\033[H")
+				return "", false
+			}
+			full = true
+		case '\r', '\n':
+			full = e.splitLine()
+		case keyBackspace, keyDelete:
+			full = e.backspace()
+		case KeyDelete:
+			full = e.deleteForward()
+		case KeyUp:
+			e.moveTo(e.row-1, e.col)
+		case KeyDown:
+			e.moveTo(e.row+1, e.col)
+		case KeyLeft:
+			if e.col > 0 {
+				e.col--
+			} else if e.row > 0 {
+				e.moveTo(e.row-1, len(e.lines[e.row-1]))
+			}
+		case KeyRight:
+			if e.col < len(e.lines[e.row]) {
+				e.col++
+			} else if e.row < len(e.lines)-1 {
+				e.moveTo(e.row+1, 0)
+			}
+		case KeyHome, keyCtrlA:
+			e.col = 0
+		case KeyEnd, keyCtrlE:
+			e.col = len(e.lines[e.row])
+		case KeyPageUp:
+			e.moveTo(e.row-e.textHeight(), e.col)
+		case KeyPageDown:
+			e.moveTo(e.row+e.textHeight(), e.col)
+		case keyCtrlN:
+			full = e.insertLines(e.row, [][]rune{{}})
+			e.col = 0
+		case keyCtrlY:
+			full = e.deleteLine()
+		case keyCtrlQ:
+			if len(e.quote) == 0 {
+				e.status = "Nothing to quote"
+				break
+			}
+			var quoted [][]rune
+			for _, q := range e.quote {
+				quoted = append(quoted, []rune(q))
+			}
+			full = e.insertLines(e.row, quoted)
+			e.moveTo(e.row+len(quoted), 0)
+		default:
+			if key >= ' ' && key < KeyUnknown {
+				full = e.insert(key) || full
+			}
+		}
+
+		if e.scroll() || full {
+			e.render()
+		} else {
+			e.renderLine(e.row)
+			e.renderStatus()
+			e.placeCursor()
+		}
+	}
+}
+
+func (e *editor) text() string {
+	var lines []string
+	for _, line := range e.lines {
+		lines = append(lines, string(line))
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n ")
+}
+
+func (e *editor) textHeight() int {
+	if h := e.height - 2; h > 1 {
+		return h
+	}
+	return 1
+}
+
+func (e *editor) wrapWidth() int {
+	if w := e.width - 1; w > 10 {
+		return w
+	}
+	return 10
+}
+
+func (e *editor) resized() bool {
+	width, height := e.s.termSize()
+	if width == e.width && height == e.height {
+		return false
+	}
+	e.width, e.height = width, height
+	return true
+}
+
+func (e *editor) moveTo(row, col int) {
+	if row < 0 {
+		row = 0
+	}
+	if row >= len(e.lines) {
+		row = len(e.lines) - 1
+	}
+	if col > len(e.lines[row]) {
+		col = len(e.lines[row])
+	}
+	e.row, e.col = row, col
+}
+
+// scroll keeps the cursor row on screen and reports whether the view moved.
+func (e *editor) scroll() bool {
+	top := e.top
+	if e.row < e.top {
+		e.top = e.row
+	}
+	if e.row >= e.top+e.textHeight() {
+		e.top = e.row - e.textHeight() + 1
+	}
+	return top != e.top
+}
+
+// insert types a character at the cursor, wrapping the last word onto a new
+// line when the line gets too long. It reports whether other lines changed.
+func (e *editor) insert(r rune) bool {
+	line := e.lines[e.row]
+	line = append(line[:e.col], append([]rune{r}, line[e.col:]...)...)
+	e.lines[e.row] = line
+	e.col++
+
+	if len(line) <= e.wrapWidth() {
+		return false
+	}
+	if len(e.lines) >= maxEditorLines {
+		e.lines[e.row] = line[:e.wrapWidth()]
+		if e.col > len(e.lines[e.row]) {
+			e.col = len(e.lines[e.row])
+		}
+		e.status = "Message is too long"
+		return false
+	}
+
+	split := e.wrapWidth()
+	for i := e.wrapWidth(); i > 0; i-- {
+		if line[i] == ' ' {
+			split = i + 1
+			break
+		}
+	}
+	rest := append([]rune{}, line[split:]...)
+	e.lines[e.row] = line[:split]
+	e.insertLines(e.row+1, [][]rune{rest})
+	if e.col >= split {
+		e.row++
+		e.col -= split
+	}
+	return true
+}
+
+func (e *editor) insertLines(at int, lines [][]rune) bool {
+	if room := maxEditorLines - len(e.lines); len(lines) > room {
+		lines = lines[:room]
+		e.status = "Message is too long"
+	}
+	tail := append([][]rune{}, e.lines[at:]...)
+	e.lines = append(append(e.lines[:at], lines...), tail...)
+	return true
+}
+
+func (e *editor) splitLine() bool {
+	if len(e.lines) >= maxEditorLines {
+		e.status = "Message is too long"
+		return false
+	}
+	line := e.lines[e.row]
+	rest := append([]rune{}, line[e.col:]...)
+	e.lines[e.row] = line[:e.col]
+	e.insertLines(e.row+1, [][]rune{rest})
+	e.row, e.col = e.row+1, 0
+	return true
+}
+
+func (e *editor) backspace() bool {
+	if e.col > 0 {
+		line := e.lines[e.row]
+		e.lines[e.row] = append(line[:e.col-1], line[e.col:]...)
+		e.col--
+		return false
+	}
+	if e.row == 0 {
+		return false
+	}
+	prev := e.lines[e.row-1]
+	e.col = len(prev)
+	e.lines[e.row-1] = append(prev, e.lines[e.row]...)
+	e.lines = append(e.lines[:e.row], e.lines[e.row+1:]...)
+	e.row--
+	return true
+}
+
+func (e *editor) deleteForward() bool {
+	line := e.lines[e.row]
+	if e.col < len(line) {
+		e.lines[e.row] = append(line[:e.col], line[e.col+1:]...)
+		return false
+	}
+	if e.row == len(e.lines)-1 {
+		return false
+	}
+	e.lines[e.row] = append(line, e.lines[e.row+1]...)
+	e.lines = append(e.lines[:e.row+1], e.lines[e.row+2:]...)
+	return true
+}
+
+func (e *editor) deleteLine() bool {
+	if len(e.lines) == 1 {
+		e.lines[0] = e.lines[0][:0]
+	} else {
+		e.lines = append(e.lines[:e.row], e.lines[e.row+1:]...)
+	}
+	e.moveTo(e.row, 0)
+	return true
+}
+
+func (e *editor) confirm(prompt string) bool {
+	e.s.printf("\033[%d;1H\033[7m%s\033[K\033[0m", e.height, prompt)
+	key, err := e.s.readKey("")
+	return err == nil && (key == 'y' || key == 'Y')
+}
+
+func (e *editor) render() {
+	e.s.printf("\033[2J\033[H\033[7m%s\033[K\033[0m", e.fit(" "+e.title))
+	for row := e.top; row < e.top+e.textHeight() && row < len(e.lines); row++ {
+		e.renderLine(row)
+	}
+	e.renderStatus()
+	e.placeCursor()
+}
+
+func (e *editor) renderLine(row int) {
+	e.s.printf("\033[%d;1H%s\033[K", row-e.top+2, string(e.lines[row]))
+}
+
+func (e *editor) renderStatus() {
+	status := fmt.Sprintf(" Line %d/%d Col %d | ^Z Save  ^C Abort  ^Y Del line  ^N Ins line", e.row+1, len(e.lines), e.col+1)
+	if len(e.quote) > 0 {
+		status += "  ^Q Quote"
+	}
+	if e.status != "" {
+		status = " " + e.status + " |" + status
+	}
+	e.s.printf("\033[%d;1H\033[7m%s\033[K\033[0m", e.height, e.fit(status))
+}
+
+func (e *editor) placeCursor() {
+	e.s.printf("\033[%d;%dH", e.row-e.top+2, e.col+1)
+}
+
+func (e *editor) fit(s string) string {
+	return truncate(s, e.width-1)
+}
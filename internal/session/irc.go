@@ -0,0 +1,204 @@
+package session
+
+import (
+	"os"
+	"strings"
+	"sync"
+
+	"gbbs/internal/irc"
+)
+
+// ircScrollback is how many recent lines are shown on joining a channel.
+const ircScrollback = 20
+
+// ircView tracks the bridged channels a user is following and the one
+// they are talking in.
+type ircView struct {
+	mu     sync.Mutex
+	joined []string
+	active string
+}
+
+func (v *ircView) following(channel string) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.indexLocked(channel) >= 0
+}
+
+func (v *ircView) current() string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.active
+}
+
+func (v *ircView) join(channel string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.indexLocked(channel) < 0 {
+		v.joined = append(v.joined, channel)
+	}
+	v.active = channel
+}
+
+// part stops following channel and returns the name it was joined under.
+// If it was the active channel, the most recently joined one left takes
+// its place.
+func (v *ircView) part(channel string) (string, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	i := v.indexLocked(channel)
+	if i < 0 {
+		return "", false
+	}
+	name := v.joined[i]
+	v.joined = append(v.joined[:i], v.joined[i+1:]...)
+	if v.active == name {
+		v.active = ""
+		if len(v.joined) > 0 {
+			v.active = v.joined[len(v.joined)-1]
+		}
+	}
+	return name, true
+}
+
+func (v *ircView) indexLocked(channel string) int {
+	for i, name := range v.joined {
+		if strings.EqualFold(name, channel) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *Session) handleIRCBridge() {
+	ircBridge := s.svc.IRCBridge
+	if ircBridge == nil {
+		s.printf("\033[0;31mIRC Bridge is not enabled.\033[0m\n")
+		return
+	}
+	channels := ircBridge.Channels()
+	if len(channels) == 0 {
+		s.printf("\033[0;31mNo IRC channels are bridged.\033[0m\n")
+		return
+	}
+
+	s.printf("\033[0;36mEntering IRC Bridge mode. Commands: /join <channel>, /part [channel], /channels, /quit\033[0m\n")
+
+	if state := ircBridge.State(); state != irc.StateConnected {
+		s.printf("\033[0;33m*** The IRC link is %s. Messages will flow once it is back.\033[0m\n", state)
+	}
+
+	view := &ircView{}
+	sub := ircBridge.Subscribe()
+	defer sub.Close()
+
+	// Incoming IRC traffic is written while the user may be typing, so the
+	// terminal implementation must tolerate concurrent writes.
+	go func() {
+		for msg := range sub.Messages() {
+			if n := sub.Dropped(); n > 0 {
+				s.printf("\r\033[0;33m*** %d IRC messages were skipped because your connection fell behind\033[0m\n", n)
+			}
+			if msg.Channel == "" {
+				s.printf("\r\033[0;33m*** %s\033[0m\n", msg.Text)
+			} else if view.following(msg.Channel) {
+				s.printf("\r%s\n", msg)
+			}
+		}
+	}()
+
+	s.joinIRCChannel(view, channels[0])
+
+	for {
+		active := view.current()
+		input, err := s.term.ReadLine(active + "> ")
+		if err != nil {
+			return
+		}
+
+		input = strings.TrimSpace(input)
+		if input == "" {
+			continue
+		}
+
+		fields := strings.Fields(input)
+		switch strings.ToLower(fields[0]) {
+		case "/quit":
+			s.printf("\033[0;36mExiting IRC Bridge mode.\033[0m\n")
+			return
+		case "/join":
+			if len(fields) < 2 {
+				s.printf("\033[0;31mUsage: /join <channel>\033[0m\n")
+				continue
+			}
+			name, ok := ircBridge.Channel(fields[1])
+			if !ok {
+				s.printf("\033[0;31m%s is not bridged. /channels lists the ones that are.\033[0m\n", fields[1])
+				continue
+			}
+			s.joinIRCChannel(view, name)
+		case "/part":
+			name := active
+			if len(fields) > 1 {
+				name = fields[1]
+			}
+			if name == "" {
+				s.printf("\033[0;31mYou are not in a channel.\033[0m\n")
+				continue
+			}
+			parted, ok := view.part(name)
+			if !ok {
+				s.printf("\033[0;31mYou are not in %s.\033[0m\n", name)
+				continue
+			}
+			s.printf("\033[0;33m*** Left %s\033[0m\n", parted)
+			if next := view.current(); next != "" && next != active {
+				s.printf("\033[0;33m*** Now talking in %s\033[0m\n", next)
+			}
+		case "/channels":
+			for _, name := range channels {
+				mark := " "
+				if name == active {
+					mark = "*"
+				} else if view.following(name) {
+					mark = "+"
+				}
+				s.printf("%s %s\n", mark, name)
+			}
+			s.printf("\033[0;36m* talking in, + following\033[0m\n")
+		default:
+			if strings.HasPrefix(input, "/") {
+				s.printf("\033[0;31mUnknown command %s\033[0m\n", fields[0])
+				continue
+			}
+			if active == "" {
+				s.printf("\033[0;31mYou are not in a channel. Use /join <channel> first.\033[0m\n")
+				continue
+			}
+			if err := ircBridge.SendMessage(active, s.username, input); err != nil {
+				s.printf("\033[0;31mMessage not sent: %v\033[0m\n", err)
+			}
+		}
+	}
+}
+
+// joinIRCChannel makes channel the one the user talks in, first showing
+// its recent traffic if they were not following it yet.
+func (s *Session) joinIRCChannel(view *ircView, channel string) {
+	if view.following(channel) {
+		view.join(channel)
+		s.printf("\033[0;33m*** Now talking in %s\033[0m\n", channel)
+		return
+	}
+
+	recent, err := s.svc.IRCBridge.GetRecentMessages(channel, ircScrollback)
+	if err != nil && !os.IsNotExist(err) {
+		s.printf("\033[0;31mError fetching recent messages: %v\033[0m\n", err)
+	}
+	for _, msg := range recent {
+		s.printf("%s\n", msg)
+	}
+
+	view.join(channel)
+	s.printf("\033[0;33m*** Now talking in %s\033[0m\n", channel)
+}
@@ -0,0 +1,247 @@
+package session
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gbbs/internal/mail"
+	"gbbs/internal/messageboard"
+	"gbbs/internal/user"
+)
+
+// offerMail tells the user about unread private mail right after login.
+func (s *Session) offerMail() {
+	n, err := s.svc.Mail.UnreadCount(s.username)
+	if err != nil {
+		s.printf("\033[0;31mError checking mail: %v\033[0m\n", err)
+		return
+	}
+	if n == 0 {
+		return
+	}
+
+	key, err := s.readKey(fmt.Sprintf("\n\033[1;33mYou have %d new mail. Read now? [Y/n]\033[0m ", n))
+	s.printf("\n")
+	if err != nil || key == 'n' || key == 'N' {
+		return
+	}
+	s.mailFolder(false)
+}
+
+func (s *Session) mailMenu() {
+	for {
+		n, err := s.svc.Mail.UnreadCount(s.username)
+		if err != nil {
+			s.printf("\033[0;31mError checking mail: %v\033[0m\n", err)
+			return
+		}
+
+		s.printf("\n\033[0;36mPrivate Mail\033[0m (%d new)\n", n)
+		choice, err := s.term.ReadLine("(I)nbox, (S)ent, (W)rite, (Q)uit: ")
+		if err != nil {
+			return
+		}
+
+		switch strings.ToLower(strings.TrimSpace(choice)) {
+		case "i":
+			if !s.mailFolder(false) {
+				return
+			}
+		case "s":
+			if !s.mailFolder(true) {
+				return
+			}
+		case "w":
+			s.composeMail("", "", nil)
+		case "q", "":
+			return
+		default:
+			s.printf("\033[0;31mInvalid choice. Please try again.\033[0m\n")
+		}
+	}
+}
+
+// mailFolder lists the inbox, or the sent folder with read receipts, and
+// lets the user open mail from it. It returns false if the connection
+// dropped.
+func (s *Session) mailFolder(sent bool) bool {
+	for {
+		var mails []mail.Mail
+		var err error
+		if sent {
+			mails, err = s.svc.Mail.Sent(s.username)
+		} else {
+			mails, err = s.svc.Mail.Inbox(s.username)
+		}
+		if err != nil {
+			s.printf("\033[0;31mError reading mail: %v\033[0m\n", err)
+			return true
+		}
+
+		if len(mails) == 0 {
+			s.printf("No mail.\n")
+			return true
+		}
+
+		width, _ := s.termSize()
+		column := "From"
+		if sent {
+			column = "To"
+		}
+		lines := []string{fmt.Sprintf("%3s   %-12s %-*s %-16s", "#", column, subjectWidth(width), "Subject", "Date")}
+		for i, m := range mails {
+			marker := " "
+			who := m.From
+			if sent {
+				who = m.To
+			}
+			if m.Read == nil {
+				// In the inbox this marks new mail; in the sent folder,
+				// mail the recipient has not opened yet.
+				marker = "*"
+			}
+			lines = append(lines, fmt.Sprintf("%3d %s %-12s %-*s %-16s",
+				i+1, marker, truncate(who, 12), subjectWidth(width), truncate(m.Subject, subjectWidth(width)),
+				m.Sent.Format("2006-01-02 15:04")))
+		}
+		if sent {
+			lines = append(lines, "(* = not yet read by recipient)")
+		} else {
+			lines = append(lines, "(* = new)")
+		}
+		s.page(lines)
+
+		input, err := s.term.ReadLine("Mail # to read (Enter to return): ")
+		if err != nil {
+			return false
+		}
+		input = strings.TrimSpace(input)
+		if input == "" {
+			return true
+		}
+		n, err := strconv.Atoi(input)
+		if err != nil || n < 1 || n > len(mails) {
+			s.printf("\033[0;31mInvalid mail number.\033[0m\n")
+			continue
+		}
+		if !s.readMail(mails[n-1]) {
+			return false
+		}
+	}
+}
+
+// readMail shows one mail and offers to reply or delete it. It returns false
+// if the connection dropped.
+func (s *Session) readMail(m mail.Mail) bool {
+	if m.To == s.username && m.Read == nil {
+		if err := s.svc.Mail.MarkRead(s.username, m.ID); err != nil {
+			s.printf("\033[0;31mError marking mail read: %v\033[0m\n", err)
+		}
+	}
+
+	width, _ := s.termSize()
+	lines := []string{
+		"",
+		fmt.Sprintf("\033[1;33m%s\033[0m", m.Subject),
+		fmt.Sprintf("\033[0;32mFrom %s to %s on %s\033[0m", m.From, m.To, m.Sent.Format("2006-01-02 15:04")),
+	}
+	if m.From == s.username {
+		if m.Read != nil {
+			lines = append(lines, fmt.Sprintf("\033[0;32mRead %s\033[0m", m.Read.Format("2006-01-02 15:04")))
+		} else {
+			lines = append(lines, "\033[0;32mNot read yet\033[0m")
+		}
+	}
+	lines = append(lines, "")
+	lines = append(lines, wrapText(m.Body, width-1)...)
+	s.page(lines)
+
+	for {
+		choice, err := s.term.ReadLine("(R)eply, (D)elete, (Q)uit: ")
+		if err != nil {
+			return false
+		}
+		switch strings.ToLower(strings.TrimSpace(choice)) {
+		case "r":
+			to := m.From
+			if m.From == s.username {
+				to = m.To
+			}
+			s.composeMail(to, messageboard.ReplySubject(m.Subject, mail.MaxSubjectLength), quoteMessage(m.From, m.Body, width))
+			return true
+		case "d":
+			if err := s.svc.Mail.Delete(s.username, m.ID); err != nil {
+				s.printf("\033[0;31mError deleting mail: %v\033[0m\n", err)
+			} else {
+				s.printf("\033[0;32mMail deleted.\033[0m\n")
+			}
+			return true
+		case "q", "":
+			return true
+		default:
+			s.printf("\033[0;31mInvalid choice. Please try again.\033[0m\n")
+		}
+	}
+}
+
+// composeMail asks for a recipient and subject unless they are given, and
+// sends the mail.
+func (s *Session) composeMail(to, subject string, quote []string) {
+	if s.level < user.LevelUser {
+		s.printf("\033[0;31mGuests cannot send mail.\033[0m\n")
+		return
+	}
+
+	if to == "" {
+		input, err := s.term.ReadLine("To: ")
+		if err != nil {
+			return
+		}
+		to = strings.TrimSpace(input)
+		if to == "" {
+			return
+		}
+		exists, err := s.svc.Users.Exists(to)
+		if err != nil {
+			s.printf("\033[0;31mError looking up user: %v\033[0m\n", err)
+			return
+		}
+		if !exists {
+			s.printf("\033[0;31mNo such user: %s\033[0m\n", to)
+			return
+		}
+	}
+
+	subjectPrompt := "Subject: "
+	if subject != "" {
+		subjectPrompt = fmt.Sprintf("Subject [%s]: ", subject)
+	}
+	input, err := s.term.ReadLine(subjectPrompt)
+	if err != nil {
+		return
+	}
+	if input = strings.TrimSpace(input); input != "" {
+		subject = input
+	}
+	if subject == "" {
+		s.printf("\033[0;31mSubject cannot be empty.\033[0m\n")
+		return
+	}
+	if len(subject) > mail.MaxSubjectLength {
+		s.printf("\033[0;31mSubject too long (max %d characters).\033[0m\n", mail.MaxSubjectLength)
+		return
+	}
+
+	body, ok := s.editText(fmt.Sprintf("Mail to %s: %s", to, subject), quote)
+	if !ok {
+		s.printf("\033[0;33mMail aborted.\033[0m\n")
+		return
+	}
+
+	if _, err := s.svc.Mail.Send(s.username, to, subject, body); err != nil {
+		s.printf("\033[0;31mError sending mail: %v\033[0m\n", err)
+	} else {
+		s.printf("\033[0;32mMail sent to %s.\033[0m\n", to)
+	}
+}
@@ -0,0 +1,126 @@
+package session
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gbbs/internal/menu"
+)
+
+type action func(s *Session, arg string)
+
+var actions = map[string]action{
+	"select_board":         func(s *Session, _ string) { s.selectBoard() },
+	"scan_new":             func(s *Session, _ string) { s.scanNewMessages() },
+	"read_messages":        func(s *Session, arg string) { s.readMessages(arg) },
+	"post_message":         func(s *Session, arg string) { s.postMessage(arg) },
+	"mail":                 func(s *Session, _ string) { s.mailMenu() },
+	"irc_bridge":           func(s *Session, _ string) { s.handleIRCBridge() },
+	"ssh_keys":             func(s *Session, _ string) { s.manageSSHKeys() },
+	"who_online":           func(s *Session, _ string) { s.whoOnline() },
+	"page_user":            func(s *Session, _ string) { s.pageUser() },
+	"teleconference":       func(s *Session, _ string) { s.teleconference() },
+	"page_sysop":           func(s *Session, _ string) { s.pageSysop() },
+	"answer_page":          func(s *Session, _ string) { s.answerPage() },
+	"admin_users":          func(s *Session, _ string) { s.adminUsers() },
+	"admin_delete_message": func(s *Session, _ string) { s.adminDeleteMessage() },
+	"admin_disconnect":     func(s *Session, _ string) { s.adminDisconnect() },
+}
+
+// KeyReader is implemented by terminals that can deliver single keypresses
+// without waiting for Enter. Menus with hotkeys enabled use it when present.
+type KeyReader interface {
+	ReadKey(prompt string) (rune, error)
+}
+
+// CheckMenus reports menu items whose action no session knows how to run.
+func CheckMenus(set *menu.Set) error {
+	for name, m := range set.Menus {
+		for _, item := range m.Items {
+			switch item.Action {
+			case menu.ActionMenu, menu.ActionBack, menu.ActionLogout:
+				continue
+			}
+			if _, ok := actions[item.Action]; !ok {
+				return fmt.Errorf("menu %q: item %q uses unknown action %q", name, item.Key, item.Action)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Session) runMenus() {
+	menus := s.svc.Menus
+	stack := []string{menus.Start}
+
+	for len(stack) > 0 {
+		m := menus.Get(stack[len(stack)-1])
+		if m.Level > s.level {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+
+		s.node.SetActivity(strings.TrimSuffix(m.Title, ":"))
+		s.showMenu(m)
+
+		choice, err := s.readChoice(m)
+		if err != nil {
+			return
+		}
+		if strings.TrimSpace(choice) == "" {
+			continue
+		}
+
+		item := m.Lookup(choice, s.level)
+		if item == nil {
+			s.printf("\033[0;31mInvalid choice. Please try again.\033[0m\n")
+			continue
+		}
+
+		switch item.Action {
+		case menu.ActionMenu:
+			stack = append(stack, item.Arg)
+		case menu.ActionBack:
+			stack = stack[:len(stack)-1]
+		case menu.ActionLogout:
+			stack = nil
+		default:
+			s.node.SetActivity(item.Label)
+			actions[item.Action](s, item.Arg)
+		}
+	}
+
+	s.printf("\033[0;33mGoodbye!\033[0m\n")
+}
+
+func (s *Session) showMenu(m *menu.Menu) {
+	if m.Screen != "" {
+		screen, err := os.ReadFile(m.Screen)
+		if err == nil {
+			s.printf("%s", screen)
+		}
+	}
+
+	s.printf("\n\033[0;36m%s\033[0m\n", m.Title)
+	for _, item := range m.Visible(s.level) {
+		s.printf("%s. %s\n", item.Key, item.Label)
+	}
+}
+
+func (s *Session) readChoice(m *menu.Menu) (string, error) {
+	prompt := m.Prompt
+	if prompt == "" {
+		prompt = "Choice: "
+	}
+
+	if m.Hotkeys {
+		key, err := s.readKey(prompt)
+		if err != nil {
+			return "", err
+		}
+		s.printf("%c\n", key)
+		return string(key), nil
+	}
+	return s.term.ReadLine(prompt)
+}
@@ -0,0 +1,379 @@
+package session
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gbbs/internal/messageboard"
+	"gbbs/internal/user"
+)
+
+func (s *Session) selectBoard() {
+	boards := s.svc.Boards.List(s.level)
+	if len(boards) == 0 {
+		s.printf("\033[0;31mNo message boards available.\033[0m\n")
+		return
+	}
+
+	unread, err := s.svc.Boards.UnreadCounts(s.username, s.level)
+	if err != nil {
+		s.printf("\033[0;31mError counting new messages: %v\033[0m\n", err)
+	}
+
+	s.printf("\n\033[0;36mMessage Boards:\033[0m\n")
+	for i, b := range boards {
+		marker := " "
+		if b == s.board {
+			marker = "*"
+		}
+		s.printf("%s%d. %-16s %-40s", marker, i+1, b.Name, b.Description)
+		if n := unread[b.Name]; n > 0 {
+			s.printf(" \033[1;33m(%d new)\033[0m", n)
+		}
+		s.printf("\n")
+	}
+
+	input, err := s.term.ReadLine("Board number (Enter to keep current): ")
+	if err != nil {
+		return
+	}
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return
+	}
+
+	n, err := strconv.Atoi(input)
+	if err != nil || n < 1 || n > len(boards) {
+		s.printf("\033[0;31mInvalid board number.\033[0m\n")
+		return
+	}
+	s.board = boards[n-1]
+	s.printf("\033[0;32mNow on board %s.\033[0m\n", s.board.Name)
+}
+
+// boardFor resolves the board an action works on: the one named in the
+// menu item's argument, or the user's current board.
+func (s *Session) boardFor(name string) *messageboard.Board {
+	board := s.board
+	if name != "" {
+		board = s.svc.Boards.Get(name)
+	}
+	if board == nil || !board.CanRead(s.level) {
+		s.printf("\033[0;31mNo such message board.\033[0m\n")
+		return nil
+	}
+	return board
+}
+
+func (s *Session) readMessages(boardName string) {
+	board := s.boardFor(boardName)
+	if board == nil {
+		return
+	}
+
+	for {
+		threads, err := board.Threads()
+		if err != nil {
+			s.printf("\033[0;31mError reading messages: %v\033[0m\n", err)
+			return
+		}
+
+		lastRead, err := board.LastRead(s.username)
+		if err != nil {
+			s.printf("\033[0;31mError reading messages: %v\033[0m\n", err)
+			return
+		}
+
+		s.printf("\n\033[0;36m%s\033[0m - %s\n", board.Name, board.Description)
+		if len(threads) == 0 {
+			s.printf("No messages yet.\n")
+			return
+		}
+
+		width, _ := s.termSize()
+		lines := []string{fmt.Sprintf("%5s   %-*s %-12s %7s", "#", subjectWidth(width), "Subject", "Author", "Replies")}
+		for _, t := range threads {
+			marker := " "
+			if t.LastID > lastRead {
+				marker = "*"
+			}
+			lines = append(lines, fmt.Sprintf("%5d %s %-*s %-12s %7d",
+				t.Root.ID, marker, subjectWidth(width), truncate(subjectOf(t.Root), subjectWidth(width)),
+				truncate(t.Root.Author, 12), t.Replies))
+		}
+		lines = append(lines, "(* = new messages)")
+		s.page(lines)
+
+		input, err := s.term.ReadLine("Message # to read (Enter to return): ")
+		if err != nil {
+			return
+		}
+		input = strings.TrimSpace(input)
+		if input == "" {
+			return
+		}
+		id, err := strconv.ParseInt(input, 10, 64)
+		if err != nil {
+			s.printf("\033[0;31mInvalid message number.\033[0m\n")
+			continue
+		}
+		if !s.readThread(board, id) {
+			return
+		}
+	}
+}
+
+// readThread shows a thread and lets the user reply to it. It returns false
+// if the connection dropped.
+func (s *Session) readThread(board *messageboard.Board, id int64) bool {
+	for {
+		thread, err := board.Thread(id)
+		if err != nil {
+			s.printf("\033[0;31mError reading thread: %v\033[0m\n", err)
+			return true
+		}
+
+		if _, completed := s.pageMessages(thread); completed {
+			if err := board.MarkThreadRead(s.username, id); err != nil {
+				s.printf("\033[0;31mError updating last-read pointer: %v\033[0m\n", err)
+			}
+		}
+
+		prompt := "(R)eply, (Q)uit: "
+		moderator := s.level >= user.LevelModerator
+		if moderator {
+			prompt = "(R)eply, (D)elete, (Q)uit: "
+		}
+		choice, err := s.term.ReadLine(prompt)
+		if err != nil {
+			return false
+		}
+		switch strings.ToLower(strings.TrimSpace(choice)) {
+		case "r":
+			last := thread[len(thread)-1].ID
+			input, err := s.term.ReadLine(fmt.Sprintf("Reply to message # [%d]: ", last))
+			if err != nil {
+				return false
+			}
+			parentID := last
+			if input = strings.TrimSpace(input); input != "" {
+				parentID, err = strconv.ParseInt(input, 10, 64)
+				if err != nil {
+					s.printf("\033[0;31mInvalid message number.\033[0m\n")
+					continue
+				}
+			}
+			s.compose(board, parentID)
+		case "d":
+			if !moderator {
+				s.printf("\033[0;31mInvalid choice. Please try again.\033[0m\n")
+				continue
+			}
+			input, err := s.term.ReadLine("Message # to delete: ")
+			if err != nil {
+				return false
+			}
+			target, err := strconv.ParseInt(strings.TrimSpace(input), 10, 64)
+			if err != nil || indexOfMessage(thread, target) < 0 {
+				s.printf("\033[0;31mThat message is not in this thread.\033[0m\n")
+				continue
+			}
+			if !s.deleteMessage(board, &thread[indexOfMessage(thread, target)].Message) {
+				continue
+			}
+			if len(thread) == 1 {
+				return true
+			}
+			if target == id {
+				// Keep following the thread through a message still in it
+				id = thread[0].ID
+				if id == target {
+					id = thread[1].ID
+				}
+			}
+		case "q", "":
+			return true
+		default:
+			s.printf("\033[0;31mInvalid choice. Please try again.\033[0m\n")
+		}
+	}
+}
+
+// offerNewScan tells the user about unread messages right after login and
+// offers to read them.
+func (s *Session) offerNewScan() {
+	unread, err := s.svc.Boards.UnreadCounts(s.username, s.level)
+	if err != nil {
+		s.printf("\033[0;31mError counting new messages: %v\033[0m\n", err)
+		return
+	}
+
+	total := 0
+	for _, n := range unread {
+		total += n
+	}
+	if total == 0 {
+		return
+	}
+
+	key, err := s.readKey(fmt.Sprintf("\n\033[1;33mYou have %d new message(s). Scan now? [Y/n]\033[0m ", total))
+	s.printf("\n")
+	if err != nil || key == 'n' || key == 'N' {
+		return
+	}
+	s.scanNewMessages()
+}
+
+// scanNewMessages walks every board with unread messages and shows them in
+// posting order, moving the last-read pointer past each board read in full.
+func (s *Session) scanNewMessages() {
+	found := false
+	for _, board := range s.svc.Boards.List(s.level) {
+		messages, err := board.NewMessages(s.username)
+		if err != nil {
+			s.printf("\033[0;31mError reading %s: %v\033[0m\n", board.Name, err)
+			continue
+		}
+		if len(messages) == 0 {
+			continue
+		}
+		found = true
+
+		key, err := s.readKey(fmt.Sprintf("\n\033[0;36m%s\033[0m: %d new. (R)ead, (S)kip, (Q)uit: ", board.Name, len(messages)))
+		s.printf("\n")
+		if err != nil {
+			return
+		}
+		switch key {
+		case 'q', 'Q':
+			return
+		case 's', 'S':
+			continue
+		}
+
+		entries := make([]messageboard.ThreadEntry, len(messages))
+		for i, msg := range messages {
+			entries[i] = messageboard.ThreadEntry{Message: msg}
+		}
+		last, completed := s.pageMessages(entries)
+		if last >= 0 {
+			if err := board.MarkRead(s.username, entries[last].ID); err != nil {
+				s.printf("\033[0;31mError updating last-read pointer: %v\033[0m\n", err)
+			}
+		}
+		if !completed {
+			return
+		}
+	}
+
+	if !found {
+		s.printf("No new messages.\n")
+	}
+}
+
+func formatMessage(entry messageboard.ThreadEntry, width int) []string {
+	indent := strings.Repeat("  ", entry.Depth)
+	if len(indent) > width/2 {
+		indent = indent[:width/2]
+	}
+
+	header := fmt.Sprintf("%s\033[1;33m#%d %s\033[0m", indent, entry.ID, subjectOf(entry.Message))
+	byline := fmt.Sprintf("%s\033[0;32mFrom %s on %s", indent, entry.Author, entry.Posted.Format("2006-01-02 15:04"))
+	if entry.ParentID != 0 {
+		byline += fmt.Sprintf(", reply to #%d", entry.ParentID)
+	}
+	byline += "\033[0m"
+
+	lines := []string{"", header, byline}
+	for _, line := range wrapText(entry.Body, width-1-len(indent)) {
+		lines = append(lines, indent+line)
+	}
+	return lines
+}
+
+// quoteMessage formats a message for quoting in a reply.
+func quoteMessage(author, body string, width int) []string {
+	lines := []string{fmt.Sprintf("%s wrote:", author)}
+	for _, line := range wrapText(body, width-3) {
+		lines = append(lines, "> "+line)
+	}
+	return lines
+}
+
+func subjectOf(msg messageboard.Message) string {
+	if msg.Subject == "" {
+		return "(no subject)"
+	}
+	return msg.Subject
+}
+
+func subjectWidth(width int) int {
+	if w := width - 30; w > 10 {
+		return w
+	}
+	return 10
+}
+
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
+
+func (s *Session) postMessage(boardName string) {
+	board := s.boardFor(boardName)
+	if board == nil {
+		return
+	}
+	s.compose(board, 0)
+}
+
+// compose asks for a new message, or a reply when parentID is set, and
+// posts it.
+func (s *Session) compose(board *messageboard.Board, parentID int64) {
+	if !board.CanPost(s.level) {
+		s.printf("\033[0;31mYou are not allowed to post on %s.\033[0m\n", board.Name)
+		return
+	}
+
+	subjectPrompt := "Subject: "
+	if parentID != 0 {
+		subjectPrompt = "Subject (Enter to keep): "
+	}
+	subject, err := s.term.ReadLine(subjectPrompt)
+	if err != nil {
+		return
+	}
+	subject = strings.TrimSpace(subject)
+	title := subject
+
+	var quote []string
+	if parentID != 0 {
+		parent, err := board.GetMessage(parentID)
+		if err != nil {
+			s.printf("\033[0;31mError reading message #%d: %v\033[0m\n", parentID, err)
+			return
+		}
+		if title == "" {
+			title = "Re: " + subjectOf(*parent)
+		}
+		width, _ := s.termSize()
+		quote = quoteMessage(parent.Author, parent.Body, width)
+	}
+
+	message, ok := s.editText(fmt.Sprintf("%s: %s", board.Name, title), quote)
+	if !ok {
+		s.printf("\033[0;33mMessage aborted.\033[0m\n")
+		return
+	}
+
+	msg, err := board.PostMessage(s.username, subject, message, parentID)
+	if err != nil {
+		s.printf("\033[0;31mError posting message: %v\033[0m\n", err)
+	} else {
+		s.printf("\033[0;32mMessage #%d posted to %s!\033[0m\n", msg.ID, board.Name)
+	}
+}
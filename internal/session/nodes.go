@@ -0,0 +1,84 @@
+package session
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gbbs/internal/user"
+)
+
+// whoOnline lists every node. Sysops also see where each caller connected
+// from.
+func (s *Session) whoOnline() {
+	sysop := s.level >= user.LevelSysop
+	header := fmt.Sprintf("%4s  %-16s %-6s %-8s %s", "Node", "User", "Via", "Online", "Activity")
+	if sysop {
+		header += "  [Address]"
+	}
+	lines := []string{"\n\033[0;36mWho's online\033[0m", header}
+
+	for _, n := range s.svc.Nodes.List() {
+		username := n.Username
+		if username == "" {
+			username = "-"
+		}
+		line := fmt.Sprintf("%4d  %-16s %-6s %-8s %s", n.Number, truncate(username, 16), n.Protocol,
+			formatDuration(time.Since(n.Since)), n.Activity)
+		if sysop {
+			line += "  [" + n.RemoteAddr + "]"
+		}
+		if n.Number == s.node.Number {
+			line = "\033[1;33m" + line + "\033[0m"
+		}
+		lines = append(lines, line)
+	}
+	s.page(lines)
+}
+
+// formatDuration shows how long someone has been online as h:mm.
+func formatDuration(d time.Duration) string {
+	minutes := int(d.Minutes())
+	return fmt.Sprintf("%d:%02d", minutes/60, minutes%60)
+}
+
+func (s *Session) adminDisconnect() {
+	if !s.requireSysop() {
+		return
+	}
+
+	s.whoOnline()
+	input, err := s.term.ReadLine("Node # to disconnect (Enter to cancel): ")
+	if err != nil {
+		return
+	}
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return
+	}
+	number, err := strconv.Atoi(input)
+	if err != nil {
+		s.printf("\033[0;31mInvalid node number.\033[0m\n")
+		return
+	}
+	if number == s.node.Number {
+		s.printf("\033[0;31mThat is your own node. Use Logout instead.\033[0m\n")
+		return
+	}
+	if !s.confirm(fmt.Sprintf("Disconnect node %d? [y/N] ", number)) {
+		return
+	}
+	if err := s.svc.Nodes.Disconnect(number); err != nil {
+		s.printf("\033[0;31mError disconnecting node: %v\033[0m\n", err)
+		return
+	}
+	s.printf("\033[0;32mNode %d disconnected.\033[0m\n", number)
+}
+
+// kickUser drops every connection of a user who was just banned or deleted.
+func (s *Session) kickUser(username string) {
+	if n := s.svc.Nodes.DisconnectUser(username); n > 0 {
+		s.printf("\033[0;32mDisconnected %s from %d node(s).\033[0m\n", username, n)
+	}
+}
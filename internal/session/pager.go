@@ -0,0 +1,137 @@
+package session
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gbbs/internal/messageboard"
+)
+
+type moreAction int
+
+const (
+	moreContinue moreAction = iota
+	moreNext
+	morePrev
+	moreJump
+	moreQuit
+)
+
+// pageMessages shows messages a screenful at a time, pausing with a
+// "-- More --" prompt from which the user can skip to the next or previous
+// message, jump to a message number, or quit. It returns the index of the
+// furthest message shown down to its last line (-1 if none) and whether the
+// user reached the end.
+func (s *Session) pageMessages(entries []messageboard.ThreadEntry) (int, bool) {
+	defer s.holdMessages()()
+
+	last := -1
+	shown := 0
+	current := -1
+	var lines []string
+	line := 0
+
+	for i := 0; i < len(entries); {
+		width, height := s.termSize()
+		if current != i {
+			lines = formatMessage(entries[i], width)
+			current, line = i, 0
+		}
+		if line >= len(lines) {
+			if i > last {
+				last = i
+			}
+			i++
+			continue
+		}
+
+		if shown >= height-1 {
+			// The message on screen is the one we are partway through,
+			// or the previous one if we stopped right between two.
+			onScreen := i
+			if line == 0 && i > 0 {
+				onScreen = i - 1
+			}
+
+			action, target, err := s.morePrompt(onScreen, len(entries))
+			if err != nil {
+				return last, false
+			}
+			shown = 0
+
+			switch action {
+			case moreNext:
+				i = onScreen + 1
+				continue
+			case morePrev:
+				i, current = onScreen-1, -1
+				if i < 0 {
+					i = 0
+				}
+				continue
+			case moreJump:
+				if j := indexOfMessage(entries, target); j >= 0 {
+					i, current = j, -1
+				} else {
+					s.printf("\033[0;31mNo message #%d here.\033[0m\n", target)
+					shown++
+				}
+				continue
+			case moreQuit:
+				return last, false
+			}
+		}
+
+		s.printf("%s\n", lines[line])
+		line++
+		shown++
+	}
+	return last, true
+}
+
+func (s *Session) morePrompt(i, total int) (moreAction, int64, error) {
+	prompt := fmt.Sprintf("\033[0;33m-- More -- [%d/%d] (Enter) more (N)ext (P)rev (Q)uit (#) jump\033[0m", i+1, total)
+	for {
+		key, err := s.readKey(prompt)
+		s.printf("\r\033[K")
+		if err != nil {
+			return moreQuit, 0, err
+		}
+
+		switch {
+		case key == '\r' || key == '\n' || key == ' ':
+			return moreContinue, 0, nil
+		case key == 'n' || key == 'N':
+			return moreNext, 0, nil
+		case key == 'p' || key == 'P':
+			return morePrev, 0, nil
+		case key == 'q' || key == 'Q':
+			return moreQuit, 0, nil
+		case key == '#' || key == 'j' || key == 'J' || (key >= '0' && key <= '9'):
+			prefix := ""
+			if key >= '0' && key <= '9' {
+				prefix = string(key)
+			}
+			input, err := s.term.ReadLine("Jump to message #" + prefix)
+			if err != nil {
+				return moreQuit, 0, err
+			}
+			id, err := strconv.ParseInt(prefix+strings.TrimSpace(input), 10, 64)
+			if err != nil {
+				s.printf("\033[0;31mInvalid message number.\033[0m\n")
+				continue
+			}
+			return moreJump, id, nil
+		}
+	}
+}
+
+func indexOfMessage(entries []messageboard.ThreadEntry, id int64) int {
+	for i, entry := range entries {
+		if entry.ID == id {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,185 @@
+package session
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"gbbs/internal/chat"
+	"gbbs/internal/config"
+	"gbbs/internal/irc"
+	"gbbs/internal/mail"
+	"gbbs/internal/menu"
+	"gbbs/internal/messageboard"
+	"gbbs/internal/node"
+	"gbbs/internal/prompt"
+	"gbbs/internal/user"
+)
+
+// Terminal is implemented by each transport (telnet, SSH) and is the only
+// thing a session knows about the connection it is running on.
+type Terminal interface {
+	io.Writer
+	ReadLine(prompt string) (string, error)
+	ReadPassword(prompt string) (string, error)
+}
+
+// Services bundles the shared backends every session talks to.
+type Services struct {
+	Config     *config.Config
+	Users      *user.Manager
+	Boards     *messageboard.Manager
+	Mail       *mail.Manager
+	IRCBridge  *irc.Bridge
+	Menus      *menu.Set
+	Nodes      *node.Registry
+	Chat       *chat.Room
+	SysopPages *chat.SysopPages
+}
+
+type Session struct {
+	term     Terminal
+	svc      *Services
+	username string
+	level    int
+	board    *messageboard.Board
+	node     *node.Node
+
+	// Pages and chat lines arrive asynchronously; these are guarded by mu
+	mu        sync.Mutex
+	hold      int
+	held      []node.Message
+	lastPager string
+}
+
+// New creates a session for a terminal connected on the given node.
+func New(term Terminal, svc *Services, n *node.Node) *Session {
+	return &Session{term: term, svc: svc, node: n}
+}
+
+func (s *Session) printf(format string, args ...interface{}) {
+	fmt.Fprintf(s.term, format, args...)
+}
+
+// Run drives the session from the welcome screen until the user logs out or
+// the connection drops.
+func (s *Session) Run() {
+	// Messages are received from the start so that callers still at the
+	// login prompt see the shutdown warning
+	stop := s.receiveMessages()
+	defer stop()
+	s.showWelcome()
+
+	for {
+		choice, err := s.term.ReadLine("\033[0;32mChoose (L)ogin or (R)egister: \033[0m")
+		if err != nil {
+			return
+		}
+
+		switch strings.ToLower(strings.TrimSpace(choice)) {
+		case "l":
+			username, err := s.login()
+			if err != nil {
+				s.printf("\033[0;31mLogin failed: %v\033[0m\n", err)
+				continue
+			}
+			s.printf("\n\033[1;32mLogin successful! Welcome, %s!\033[0m\n", username)
+			s.start(username)
+			return
+		case "r":
+			username, err := s.register()
+			if err != nil {
+				s.printf("\033[0;31mRegistration failed: %v\033[0m\n", err)
+				continue
+			}
+			s.printf("\n\033[1;32mRegistration successful! Welcome, %s!\033[0m\n", username)
+			s.start(username)
+			return
+		default:
+			s.printf("\033[0;31mInvalid choice. Please enter 'L' or 'R'.\033[0m\n")
+		}
+	}
+}
+
+// RunAs is Run for a user the transport has already authenticated, such as
+// an SSH public key login.
+func (s *Session) RunAs(username string) {
+	stop := s.receiveMessages()
+	defer stop()
+	s.showWelcome()
+	s.printf("\033[1;32mWelcome back, %s!\033[0m\n", username)
+	s.start(username)
+}
+
+func (s *Session) showWelcome() {
+	welcomeScreen, err := prompt.ReadWelcomeScreen(s.svc.Config)
+	if err != nil {
+		log.Printf("Error reading welcome screen: %v", err)
+		welcomeScreen = "Welcome to GBBS!\n\n"
+	}
+	s.printf("%s", welcomeScreen)
+	s.printf("\n\n\n\n\n") // Add five newlines after the welcome screen
+}
+
+func (s *Session) start(username string) {
+	s.username = username
+	level, err := s.svc.Users.Level(username)
+	if err != nil {
+		log.Printf("Error looking up access level for %s: %v", username, err)
+	}
+	s.level = level
+	s.node.SetUser(username)
+	s.board = s.svc.Boards.Default(s.level)
+	width, height := s.termSize()
+	log.Printf("Session for %s: TERM=%q %dx%d", username, s.termType(), width, height)
+	time.Sleep(2 * time.Second)
+	s.offerMail()
+	s.offerNewScan()
+	s.runMenus()
+}
+
+func (s *Session) login() (string, error) {
+	username, err := s.term.ReadLine("Username: ")
+	if err != nil {
+		return "", err
+	}
+	username = strings.TrimSpace(username)
+
+	password, err := s.term.ReadPassword("Password: ")
+	if err != nil {
+		return "", err
+	}
+
+	authenticated, err := s.svc.Users.Authenticate(username, password)
+	if err != nil {
+		return "", err
+	}
+	if !authenticated {
+		return "", fmt.Errorf("invalid username or password")
+	}
+
+	return username, nil
+}
+
+func (s *Session) register() (string, error) {
+	username, err := s.term.ReadLine("Choose a username: ")
+	if err != nil {
+		return "", err
+	}
+	username = strings.TrimSpace(username)
+
+	password, err := s.term.ReadPassword("Choose a password: ")
+	if err != nil {
+		return "", err
+	}
+
+	err = s.svc.Users.CreateUser(username, password)
+	if err != nil {
+		return "", err
+	}
+
+	return username, nil
+}
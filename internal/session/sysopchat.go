@@ -0,0 +1,427 @@
+package session
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gbbs/internal/chat"
+	"gbbs/internal/node"
+	"gbbs/internal/user"
+)
+
+// sysopPageTimeout is how long a caller waits for a sysop to answer before
+// the page is left as mail instead.
+const sysopPageTimeout = 60 * time.Second
+
+func (s *Session) pageSysop() {
+	reason, err := s.term.ReadLine("Reason for paging the sysop: ")
+	if err != nil {
+		return
+	}
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return
+	}
+
+	var sysopNodes []*node.Node
+	for _, info := range s.svc.Nodes.List() {
+		if info.Protocol == "web" || info.Number == s.node.Number || info.Username == "" {
+			continue
+		}
+		if level, err := s.svc.Users.Level(info.Username); err == nil && level >= user.LevelSysop {
+			if n := s.svc.Nodes.Get(info.Number); n != nil {
+				sysopNodes = append(sysopNodes, n)
+			}
+		}
+	}
+	if len(sysopNodes) == 0 {
+		s.leaveSysopPage(reason)
+		return
+	}
+
+	req := s.svc.SysopPages.Request(s.node, reason)
+	for _, n := range sysopNodes {
+		n.Deliver(node.Message{
+			Kind: node.KindSystem,
+			Text: fmt.Sprintf("\a%s on node %d is paging the sysop: %s (answer from the sysop menu)", s.username, s.node.Number, reason),
+		})
+	}
+
+	s.printf("\033[0;33mPaging the sysop, press Enter to cancel")
+	s.node.SetActivity("Paging the sysop")
+
+	// Reading while we wait is how we notice the caller hanging up
+	input := s.readChatInput()
+	timeout := time.After(sysopPageTimeout)
+	ring := time.NewTicker(5 * time.Second)
+	defer ring.Stop()
+	for {
+		select {
+		case link := <-req.Answered():
+			s.printf("\033[0m\n")
+			s.sysopChat(link, "Sysop", input)
+			return
+		case in := <-input:
+			s.printf("\033[0m\n")
+			if !s.svc.SysopPages.Cancel(req) {
+				// A sysop answered just as the caller gave up
+				link := <-req.Answered()
+				if in.err != nil {
+					link.Close()
+					return
+				}
+				s.sysopChat(link, "Sysop", nil)
+				return
+			}
+			if in.err == nil {
+				s.printf("\033[0;33mPage cancelled.\033[0m\n")
+			}
+			return
+		case <-ring.C:
+			s.printf(".\a")
+		case <-timeout:
+			s.printf("\033[0m\n")
+			if !s.svc.SysopPages.Cancel(req) {
+				// A sysop answered just as the page timed out
+				s.sysopChat(<-req.Answered(), "Sysop", input)
+				return
+			}
+			s.printf("\033[0;33mThe sysop did not answer.\033[0m\n")
+			s.leaveSysopPage(reason)
+			s.printf("Press Enter to continue.")
+			<-input
+			s.printf("\n")
+			return
+		}
+	}
+}
+
+// chatInput is the result of a read started before a sysop chat, which the
+// chat takes over rather than starting a second read alongside it.
+type chatInput struct {
+	key  rune
+	line string
+	err  error
+}
+
+// readChatInput starts reading the caller's next input the way sysopChat
+// reads it: a keystroke for the split screen, a whole line otherwise.
+func (s *Session) readChatInput() <-chan chatInput {
+	ch := make(chan chatInput, 1)
+	split := s.canUseEditor()
+	go func() {
+		var in chatInput
+		if split {
+			in.key, in.err = s.readKey("")
+		} else {
+			in.line, in.err = s.term.ReadLine("")
+		}
+		ch <- in
+	}()
+	return ch
+}
+
+// leaveSysopPage queues a page as mail to every sysop, for when nobody
+// answers.
+func (s *Session) leaveSysopPage(reason string) {
+	users, err := s.svc.Users.ListUsers("")
+	if err != nil {
+		s.printf("\033[0;31mError finding the sysop: %v\033[0m\n", err)
+		return
+	}
+
+	sent := 0
+	body := fmt.Sprintf("%s paged the sysop at %s:\n\n%s", s.username, time.Now().Format("2006-01-02 15:04"), reason)
+	for _, u := range users {
+		if user.RoleLevel(u.Role) < user.LevelSysop || u.Username == s.username {
+			continue
+		}
+		if _, err := s.svc.Mail.Send(s.username, u.Username, "Sysop page", body); err == nil {
+			sent++
+		}
+	}
+	if sent == 0 {
+		s.printf("\033[0;31mThe sysop is not available.\033[0m\n")
+		return
+	}
+	s.printf("\033[0;32mThe sysop is not available; your page was left as mail.\033[0m\n")
+}
+
+func (s *Session) answerPage() {
+	if !s.requireSysop() {
+		return
+	}
+
+	pending := s.svc.SysopPages.Pending()
+	if len(pending) == 0 {
+		s.printf("Nobody is paging.\n")
+		return
+	}
+	for _, req := range pending {
+		s.printf("Node %d: %s, %s ago: %s\n", req.Node, req.Caller, time.Since(req.Time).Truncate(time.Second), req.Reason)
+	}
+
+	input, err := s.term.ReadLine("Node # to chat with (Enter to cancel): ")
+	if err != nil {
+		return
+	}
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return
+	}
+	number, err := strconv.Atoi(input)
+	if err != nil {
+		s.printf("\033[0;31mInvalid node number.\033[0m\n")
+		return
+	}
+	link, req, err := s.svc.SysopPages.Accept(number)
+	if err != nil {
+		s.printf("\033[0;31m%v\033[0m\n", err)
+		return
+	}
+	s.sysopChat(link, req.Caller, nil)
+}
+
+// sysopChat runs a two-way chat over link: split-screen, keystroke by
+// keystroke, on ANSI terminals, and line by line otherwise. pending, if not
+// nil, is a read from readChatInput that supplies the first input.
+func (s *Session) sysopChat(link *chat.End, peer string, pending <-chan chatInput) {
+	defer s.holdMessages()()
+	defer link.Close()
+	s.node.SetActivity("Chatting with " + peer)
+
+	if !s.canUseEditor() {
+		s.lineChat(link, peer, pending)
+		return
+	}
+
+	width, height := s.termSize()
+	sc := newSplitChat(s, width, height, peer)
+	sc.render()
+	defer sc.finish()
+
+	go func() {
+		for {
+			select {
+			case r := <-link.Recv():
+				sc.put(&sc.remote, r)
+			case <-link.Done():
+				sc.status("Chat ended. Press any key.")
+				return
+			}
+		}
+	}()
+
+	for {
+		var key rune
+		var err error
+		if pending != nil {
+			in := <-pending
+			key, err, pending = in.key, in.err, nil
+		} else {
+			key, err = s.readKey("")
+		}
+		if err != nil {
+			return
+		}
+		select {
+		case <-link.Done():
+			return
+		default:
+		}
+		if key == KeyEscape || key == keyCtrlZ {
+			return
+		}
+		if key >= KeyUnknown && key <= KeyPageDown {
+			continue
+		}
+		sc.put(&sc.local, key)
+		link.Send(key)
+	}
+}
+
+// lineChat is sysop chat for terminals that cannot do the split screen.
+func (s *Session) lineChat(link *chat.End, peer string, pending <-chan chatInput) {
+	s.printf("\033[0;36mChatting with %s. Type /quit to end.\033[0m\n", peer)
+
+	// left is closed before the link when we end the chat ourselves, so
+	// the receiver does not report the other side leaving
+	left := make(chan struct{})
+	defer close(left)
+
+	go func() {
+		var line []rune
+		for {
+			select {
+			case r := <-link.Recv():
+				switch r {
+				case '\r', '\n':
+					s.printf("\033[0;32m<%s>\033[0m %s\n", peer, string(line))
+					line = line[:0]
+				case keyBackspace, keyDelete:
+					if len(line) > 0 {
+						line = line[:len(line)-1]
+					}
+				default:
+					line = append(line, r)
+				}
+			case <-link.Done():
+				select {
+				case <-left:
+				default:
+					s.printf("\033[0;33m*** %s ended the chat. Press Enter.\033[0m\n", peer)
+				}
+				return
+			}
+		}
+	}()
+
+	for {
+		var input string
+		var err error
+		if pending != nil {
+			in := <-pending
+			input, err, pending = in.line, in.err, nil
+		} else {
+			input, err = s.term.ReadLine("> ")
+		}
+		if err != nil {
+			return
+		}
+		select {
+		case <-link.Done():
+			return
+		default:
+		}
+		if strings.TrimSpace(input) == "/quit" {
+			return
+		}
+		for _, r := range input + "\r" {
+			if !link.Send(r) {
+				return
+			}
+		}
+	}
+}
+
+// splitChat draws the sysop chat screen: the other side's typing in the top
+// half and ours in the bottom half.
+type splitChat struct {
+	s             *Session
+	mu            sync.Mutex
+	width, height int
+	peer          string
+	remote, local chatPane
+	ended         bool
+}
+
+type chatPane struct {
+	top, rows int
+	lines     [][]rune
+}
+
+func newSplitChat(s *Session, width, height int, peer string) *splitChat {
+	mid := height / 2
+	return &splitChat{
+		s:      s,
+		width:  width,
+		height: height,
+		peer:   peer,
+		remote: chatPane{top: 2, rows: mid - 2, lines: [][]rune{{}}},
+		local:  chatPane{top: mid + 1, rows: height - mid - 1, lines: [][]rune{{}}},
+	}
+}
+
+// put adds a keystroke to a pane and redraws it.
+func (c *splitChat) put(p *chatPane, r rune) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ended {
+		return
+	}
+
+	cur := len(p.lines) - 1
+	switch {
+	case r == '\r' || r == '\n':
+		p.lines = append(p.lines, nil)
+	case r == keyBackspace || r == keyDelete:
+		if n := len(p.lines[cur]); n > 0 {
+			p.lines[cur] = p.lines[cur][:n-1]
+		}
+	case r < ' ':
+		return
+	default:
+		if len(p.lines[cur]) >= c.width-1 {
+			p.lines = append(p.lines, nil)
+			cur++
+		}
+		p.lines[cur] = append(p.lines[cur], r)
+	}
+	if len(p.lines) > p.rows {
+		p.lines = p.lines[len(p.lines)-p.rows:]
+	}
+
+	var b strings.Builder
+	c.drawPane(&b, p)
+	c.placeCursor(&b)
+	c.s.printf("%s", b.String())
+}
+
+func (c *splitChat) render() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString("\033[2J")
+	c.drawBar(&b, 1, " "+c.peer)
+	c.drawPane(&b, &c.remote)
+	c.drawBar(&b, c.local.top-1, " "+c.s.username)
+	c.drawPane(&b, &c.local)
+	c.drawBar(&b, c.height, " ESC or ^Z ends the chat")
+	c.placeCursor(&b)
+	c.s.printf("%s", b.String())
+}
+
+func (c *splitChat) status(text string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ended {
+		return
+	}
+
+	var b strings.Builder
+	c.drawBar(&b, c.height, " "+text)
+	c.placeCursor(&b)
+	c.s.printf("%s", b.String())
+}
+
+// finish clears the chat screen. Nothing is drawn after it, even if the
+// other side is still typing.
+func (c *splitChat) finish() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ended = true
+	c.s.printf("\033[2J\033[H")
+}
+
+func (c *splitChat) drawBar(b *strings.Builder, row int, text string) {
+	fmt.Fprintf(b, "\033[%d;1H\033[7m%s\033[K\033[0m", row, truncate(text, c.width-1))
+}
+
+func (c *splitChat) drawPane(b *strings.Builder, p *chatPane) {
+	for i := 0; i < p.rows; i++ {
+		fmt.Fprintf(b, "\033[%d;1H\033[K", p.top+i)
+		if i < len(p.lines) {
+			b.WriteString(string(p.lines[i]))
+		}
+	}
+}
+
+// placeCursor leaves the cursor where we are typing.
+func (c *splitChat) placeCursor(b *strings.Builder) {
+	row := len(c.local.lines) - 1
+	fmt.Fprintf(b, "\033[%d;%dH", c.local.top+row, len(c.local.lines[row])+1)
+}
@@ -0,0 +1,76 @@
+package ssh
+
+import (
+	"fmt"
+	"log"
+
+	"golang.org/x/crypto/ssh"
+
+	"gbbs/internal/session"
+)
+
+// permUser is the permissions extension carrying the BBS account a
+// connection authenticated as during the handshake.
+const permUser = "gbbs-user"
+
+// newServerConfig authenticates account holders during the SSH handshake, by
+// public key or password, so they skip the in-BBS login prompt. Usernames
+// without an account are let through to the BBS login/register screen.
+func newServerConfig(svc *session.Services) *ssh.ServerConfig {
+	return &ssh.ServerConfig{
+		PublicKeyCallback: func(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			username, err := svc.Users.FindUserByKey(key)
+			if err != nil {
+				return nil, err
+			}
+			if username != c.User() {
+				return nil, fmt.Errorf("key is not registered to %s", c.User())
+			}
+			log.Printf("SSH key login for %s from %s (%s)", username, c.RemoteAddr(), ssh.FingerprintSHA256(key))
+			return userPermissions(username), nil
+		},
+		PasswordCallback: func(c ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			return passwordAuth(svc, c, string(password))
+		},
+		KeyboardInteractiveCallback: func(c ssh.ConnMetadata, challenge ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			exists, err := svc.Users.Exists(c.User())
+			if err != nil {
+				return nil, err
+			}
+			if !exists {
+				return &ssh.Permissions{}, nil
+			}
+			answers, err := challenge("", "", []string{"Password: "}, []bool{false})
+			if err != nil {
+				return nil, err
+			}
+			if len(answers) != 1 {
+				return nil, fmt.Errorf("expected one answer, got %d", len(answers))
+			}
+			return passwordAuth(svc, c, answers[0])
+		},
+	}
+}
+
+func passwordAuth(svc *session.Services, c ssh.ConnMetadata, password string) (*ssh.Permissions, error) {
+	exists, err := svc.Users.Exists(c.User())
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return &ssh.Permissions{}, nil
+	}
+
+	authenticated, err := svc.Users.Authenticate(c.User(), password)
+	if err != nil {
+		return nil, err
+	}
+	if !authenticated {
+		return nil, fmt.Errorf("invalid password for %s", c.User())
+	}
+	return userPermissions(c.User()), nil
+}
+
+func userPermissions(username string) *ssh.Permissions {
+	return &ssh.Permissions{Extensions: map[string]string{permUser: username}}
+}
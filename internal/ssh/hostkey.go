@@ -0,0 +1,86 @@
+package ssh
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"gbbs/internal/config"
+)
+
+// loadHostKeys returns a signer for every configured host key, generating
+// and saving any key that does not exist yet so that the server presents
+// the same identity across restarts.
+func loadHostKeys(hostKeys []config.HostKey) ([]ssh.Signer, error) {
+	if len(hostKeys) == 0 {
+		return nil, fmt.Errorf("no SSH host keys configured")
+	}
+
+	var signers []ssh.Signer
+	for _, hk := range hostKeys {
+		signer, err := loadHostKey(hk)
+		if err != nil {
+			return nil, fmt.Errorf("host key %s: %v", hk.Path, err)
+		}
+		log.Printf("SSH host key %s: %s %s", hk.Path, signer.PublicKey().Type(), ssh.FingerprintSHA256(signer.PublicKey()))
+		signers = append(signers, signer)
+	}
+	return signers, nil
+}
+
+func loadHostKey(hk config.HostKey) (ssh.Signer, error) {
+	data, err := os.ReadFile(hk.Path)
+	if err == nil {
+		return ssh.ParsePrivateKey(data)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	log.Printf("Generating %s SSH host key at %s", hk.Type, hk.Path)
+	key, err := generateHostKey(hk.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := ssh.MarshalPrivateKey(key, "gbbs host key")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(hk.Path, pem.EncodeToMemory(block), 0600); err != nil {
+		return nil, err
+	}
+
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(hk.Path+".pub", ssh.MarshalAuthorizedKey(signer.PublicKey()), 0644); err != nil {
+		log.Printf("Failed to write public host key: %v", err)
+	}
+	return signer, nil
+}
+
+func generateHostKey(keyType string) (crypto.Signer, error) {
+	switch strings.ToLower(keyType) {
+	case "ed25519":
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	case "ecdsa":
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "rsa":
+		return rsa.GenerateKey(rand.Reader, 3072)
+	default:
+		return nil, fmt.Errorf("unsupported host key type %q", keyType)
+	}
+}
@@ -1,70 +1,79 @@
 package ssh
 
 import (
-	"crypto/rand"
-	"crypto/rsa"
+	"context"
 	"fmt"
-	"io"
 	"log"
 	"net"
-	"os"
-	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/crypto/ssh"
-	"golang.org/x/term"
 
-	"gbbs/internal/config"
-	"gbbs/internal/irc"
-	"gbbs/internal/messageboard"
-	"gbbs/internal/user"
+	"gbbs/internal/session"
 )
 
-func generateSSHKey() (ssh.Signer, error) {
-	key, err := rsa.GenerateKey(rand.Reader, 2048)
-	if err != nil {
-		return nil, err
-	}
-	return ssh.NewSignerFromKey(key)
-}
+// handshakeTimeout bounds how long a client may take to authenticate.
+const handshakeTimeout = 30 * time.Second
 
-func Serve(cfg *config.Config, userManager *user.Manager, messageBoard *messageboard.MessageBoard, ircBridge *irc.Bridge) error {
-	config := &ssh.ServerConfig{
-		NoClientAuth: true,
-	}
+// Serve accepts SSH connections until ctx is cancelled, then waits for the
+// connections already open to end.
+func Serve(ctx context.Context, svc *session.Services) error {
+	config := newServerConfig(svc)
 
-	private, err := generateSSHKey()
+	hostKeys, err := loadHostKeys(svc.Config.SSHHostKeys)
 	if err != nil {
-		return fmt.Errorf("failed to generate SSH key: %v", err)
+		return fmt.Errorf("failed to load SSH host keys: %v", err)
+	}
+	for _, key := range hostKeys {
+		config.AddHostKey(key)
 	}
 
-	config.AddHostKey(private)
-
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.SSHPort))
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", svc.Config.SSHPort))
 	if err != nil {
 		return err
 	}
-	defer listener.Close()
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
 
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
 			log.Printf("Failed to accept incoming connection: %v", err)
 			continue
 		}
-		go handleConnection(conn, config, cfg, userManager, messageBoard, ircBridge)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handleConnection(conn, config, svc)
+		}()
 	}
 }
 
-func handleConnection(conn net.Conn, config *ssh.ServerConfig, cfg *config.Config, userManager *user.Manager, messageBoard *messageboard.MessageBoard, ircBridge *irc.Bridge) {
+func handleConnection(conn net.Conn, config *ssh.ServerConfig, svc *session.Services) {
 	defer conn.Close()
 
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
 	sshConn, chans, reqs, err := ssh.NewServerConn(conn, config)
 	if err != nil {
 		log.Printf("Failed to handshake: %v", err)
 		return
 	}
 	defer sshConn.Close()
+	conn.SetDeadline(time.Time{})
+
+	// The node is the whole connection, so dropping it closes every
+	// channel the client opened
+	n := svc.Nodes.Add("ssh", sshConn.RemoteAddr().String(), func() { sshConn.Close() })
+	defer svc.Nodes.Remove(n)
 
 	go ssh.DiscardRequests(reqs)
 
@@ -79,222 +88,110 @@ func handleConnection(conn net.Conn, config *ssh.ServerConfig, cfg *config.Confi
 			continue
 		}
 
-		go func(in <-chan *ssh.Request) {
-			for req := range in {
-				switch req.Type {
-				case "shell":
-					req.Reply(true, nil)
-				case "pty-req":
-					req.Reply(true, nil)
+		t := &terminal{Console: session.NewConsole(channel, channel), width: 80, height: 24}
+		go func() {
+			// A caller gets one session per connection, so hang up with it
+			defer sshConn.Close()
+			handleRequests(requests, channel, t, func() {
+				s := session.New(t, svc, n)
+				if username := sshConn.Permissions.Extensions[permUser]; username != "" {
+					s.RunAs(username)
+				} else {
+					s.Run()
 				}
-			}
-		}(requests)
-
-		terminal := term.NewTerminal(channel, "")
-		go handleSSHSession(terminal, cfg, userManager, messageBoard, ircBridge)
+			})
+		}()
 	}
 }
 
-func handleSSHSession(terminal *term.Terminal, cfg *config.Config, userManager *user.Manager, messageBoard *messageboard.MessageBoard, ircBridge *irc.Bridge) {
-	defer terminal.Write([]byte("Goodbye!\n"))
-
-	welcomeScreen, err := os.ReadFile(cfg.WelcomeScreenPath)
-	if err != nil {
-		log.Printf("Error reading welcome screen: %v", err)
-		terminal.Write([]byte("Welcome to GBBS!\n\n"))
-	} else {
-		terminal.Write(welcomeScreen)
-	}
-	terminal.Write([]byte("\n\n\n\n\n")) // Add five newlines after the welcome screen
+type ptyRequest struct {
+	Term     string
+	Columns  uint32
+	Rows     uint32
+	Width    uint32
+	Height   uint32
+	Modelist string
+}
 
-	for {
-		terminal.SetPrompt("\033[0;32mChoose (L)ogin or (R)egister: \033[0m")
-		choice, err := terminal.ReadLine()
-		if err != nil {
-			if err == io.EOF {
-				return
-			}
-			log.Printf("Error reading input: %v", err)
-			continue
-		}
+type windowChange struct {
+	Columns uint32
+	Rows    uint32
+	Width   uint32
+	Height  uint32
+}
 
-		switch strings.ToLower(choice) {
-		case "l":
-			username, err := login(terminal, userManager)
-			if err != nil {
-				terminal.Write([]byte(fmt.Sprintf("\033[0;31mLogin failed: %v\033[0m\n", err)))
+// handleRequests tracks the client's terminal through pty-req and
+// window-change, and starts the BBS session when the client asks for a shell.
+func handleRequests(in <-chan *ssh.Request, channel ssh.Channel, t *terminal, run func()) {
+	started := false
+	for req := range in {
+		switch req.Type {
+		case "pty-req":
+			var pty ptyRequest
+			if err := ssh.Unmarshal(req.Payload, &pty); err != nil {
+				req.Reply(false, nil)
 				continue
 			}
-			terminal.Write([]byte(fmt.Sprintf("\n\033[1;32mLogin successful! Welcome, %s!\033[0m\n", username)))
-			time.Sleep(2 * time.Second)
-			handleBBS(username, terminal, messageBoard, ircBridge)
-			return
-		case "r":
-			username, err := register(terminal, userManager)
-			if err != nil {
-				terminal.Write([]byte(fmt.Sprintf("\033[0;31mRegistration failed: %v\033[0m\n", err)))
-				continue
+			t.setTermType(pty.Term)
+			t.setSize(int(pty.Columns), int(pty.Rows))
+			req.Reply(true, nil)
+		case "window-change":
+			var wc windowChange
+			if err := ssh.Unmarshal(req.Payload, &wc); err == nil {
+				t.setSize(int(wc.Columns), int(wc.Rows))
+			}
+		case "shell":
+			req.Reply(!started, nil)
+			if !started {
+				started = true
+				go func() {
+					defer channel.Close()
+					run()
+					channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+				}()
 			}
-			terminal.Write([]byte(fmt.Sprintf("\n\033[1;32mRegistration successful! Welcome, %s!\033[0m\n", username)))
-			time.Sleep(2 * time.Second)
-			handleBBS(username, terminal, messageBoard, ircBridge)
-			return
 		default:
-			terminal.Write([]byte("\033[0;31mInvalid choice. Please enter 'L' or 'R'.\033[0m\n"))
+			if req.WantReply {
+				req.Reply(false, nil)
+			}
 		}
 	}
 }
 
-func login(terminal *term.Terminal, userManager *user.Manager) (string, error) {
-	terminal.SetPrompt("Username: ")
-	username, err := terminal.ReadLine()
-	if err != nil {
-		return "", err
-	}
+// terminal is an SSH session channel with line editing done by the shared
+// session console.
+type terminal struct {
+	*session.Console
 
-	terminal.SetPrompt("Password: ")
-	password, err := terminal.ReadPassword("Password: ")
-	if err != nil {
-		return "", err
-	}
-
-	authenticated, err := userManager.Authenticate(username, password)
-	if err != nil {
-		return "", err
-	}
-	if !authenticated {
-		return "", fmt.Errorf("invalid username or password")
-	}
-
-	return username, nil
+	mu       sync.Mutex
+	width    int
+	height   int
+	termType string
 }
 
-func register(terminal *term.Terminal, userManager *user.Manager) (string, error) {
-	terminal.SetPrompt("Choose a username: ")
-	username, err := terminal.ReadLine()
-	if err != nil {
-		return "", err
-	}
-
-	terminal.SetPrompt("Choose a password: ")
-	password, err := terminal.ReadPassword("Choose a password: ")
-	if err != nil {
-		return "", err
-	}
-
-	err = userManager.CreateUser(username, password)
-	if err != nil {
-		return "", err
+func (t *terminal) setSize(width, height int) {
+	if width <= 0 || height <= 0 {
+		return
 	}
-
-	return username, nil
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.width, t.height = width, height
 }
 
-func handleBBS(username string, terminal *term.Terminal, messageBoard *messageboard.MessageBoard, ircBridge *irc.Bridge) {
-	for {
-		terminal.Write([]byte("\n\033[0;36mBBS Menu:\033[0m\n"))
-		terminal.Write([]byte("1. Read messages\n"))
-		terminal.Write([]byte("2. Post message\n"))
-		terminal.Write([]byte("3. IRC Bridge\n"))
-		terminal.Write([]byte("4. Logout\n"))
-		terminal.SetPrompt("Choice: ")
-
-		choice, err := terminal.ReadLine()
-		if err != nil {
-			log.Printf("Error reading input: %v", err)
-			continue
-		}
-
-		switch strings.TrimSpace(choice) {
-		case "1":
-			messages, err := messageBoard.GetMessages()
-			if err != nil {
-				terminal.Write([]byte(fmt.Sprintf("\033[0;31mError reading messages: %v\033[0m\n", err)))
-			} else {
-				for _, msg := range messages {
-					terminal.Write([]byte(fmt.Sprintf("%s\n", msg)))
-				}
-			}
-		case "2":
-			terminal.SetPrompt("Enter your message: ")
-			message, err := terminal.ReadLine()
-			if err != nil {
-				terminal.Write([]byte(fmt.Sprintf("\033[0;31mError reading message: %v\033[0m\n", err)))
-				continue
-			}
-			err = messageBoard.PostMessage(username, message)
-			if err != nil {
-				terminal.Write([]byte(fmt.Sprintf("\033[0;31mError posting message: %v\033[0m\n", err)))
-			} else {
-				terminal.Write([]byte("\033[0;32mMessage posted successfully!\033[0m\n"))
-			}
-		case "3":
-			handleIRCBridge(username, terminal, ircBridge)
-		case "4":
-			return
-		default:
-			terminal.Write([]byte("\033[0;31mInvalid choice. Please try again.\033[0m\n"))
-		}
-	}
+func (t *terminal) setTermType(termType string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.termType = termType
 }
 
-func handleIRCBridge(username string, terminal *term.Terminal, ircBridge *irc.Bridge) {
-	if ircBridge == nil {
-		terminal.Write([]byte("\033[0;31mIRC Bridge is not enabled.\033[0m\n"))
-		return
-	}
-
-	terminal.Write([]byte("\033[0;36mEntering IRC Bridge mode. Type '/quit' to exit.\033[0m\n"))
-
-	// Fetch recent messages
-	recentMessages, err := ircBridge.GetRecentMessages(50) // Get last 50 messages
-	if err != nil {
-		terminal.Write([]byte(fmt.Sprintf("\033[0;31mError fetching recent messages: %v\033[0m\n", err)))
-	} else {
-		for _, msg := range recentMessages {
-			terminal.Write([]byte(fmt.Sprintf("%s\n", msg)))
-		}
-	}
-
-	ircMsgChan := ircBridge.GetMessageChannel()
-	quit := make(chan struct{})
-
-	// Goroutine to handle incoming IRC messages
-	go func() {
-		for {
-			select {
-			case msg := <-ircMsgChan:
-				terminal.Write([]byte(fmt.Sprintf("\r%s\n> ", msg)))
-			case <-quit:
-				return
-			}
-		}
-	}()
-
-	// Main loop for user input
-	for {
-		terminal.SetPrompt("> ")
-		input, err := terminal.ReadLine()
-		if err != nil {
-			if err == io.EOF {
-				close(quit)
-				return
-			}
-			log.Printf("Error reading input: %v", err)
-			continue
-		}
-
-		input = strings.TrimSpace(input)
-
-		if input == "/quit" {
-			close(quit)
-			terminal.Write([]byte("\033[0;36mExiting IRC Bridge mode.\033[0m\n"))
-			return
-		}
+func (t *terminal) Size() (width, height int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.width, t.height
+}
 
-		// Send user message to IRC
-		for _, channel := range ircBridge.Config.Channels {
-			ircBridge.SendMessage(channel.Name, username, input)
-		}
-	}
+func (t *terminal) TermType() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.termType
 }
@@ -0,0 +1,272 @@
+package telnet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"sync"
+)
+
+// Telnet commands (RFC 854)
+const (
+	cmdSE   = 240
+	cmdSB   = 250
+	cmdWILL = 251
+	cmdWONT = 252
+	cmdDO   = 253
+	cmdDONT = 254
+	cmdIAC  = 255
+)
+
+// Telnet options
+const (
+	optEcho  = 1  // RFC 857
+	optSGA   = 3  // RFC 858
+	optTType = 24 // RFC 1091
+	optNAWS  = 31 // RFC 1073
+)
+
+// Terminal type subnegotiation commands
+const (
+	ttypeIS   = 0
+	ttypeSEND = 1
+)
+
+const maxSubnegotiation = 256
+
+const (
+	stateData = iota
+	stateIAC
+	stateOption
+	stateSB
+	stateSBIAC
+)
+
+// conn wraps a raw telnet connection. Reads return the user's input with all
+// IAC sequences removed and CR LF / CR NUL folded to CR; writes escape
+// literal IAC bytes. Option negotiation is answered as a side effect of
+// reading.
+type conn struct {
+	net.Conn
+
+	raw   []byte
+	state int
+	cmd   byte
+	sb    []byte
+	cr    bool
+
+	mu       sync.Mutex
+	us       [256]bool // options enabled on our side
+	him      [256]bool // options enabled on the client's side
+	width    int
+	height   int
+	termType string
+
+	// onEcho is called when the client agrees or refuses to let the
+	// server echo; local is true when the client will echo for itself.
+	onEcho func(local bool)
+}
+
+func newConn(c net.Conn) *conn {
+	return &conn{Conn: c, raw: make([]byte, 1024)}
+}
+
+// negotiate asks the client for character-at-a-time mode with server-side
+// echo, and for its window size and terminal type.
+func (c *conn) negotiate() error {
+	c.mu.Lock()
+	c.us[optEcho] = true
+	c.us[optSGA] = true
+	c.him[optSGA] = true
+	c.him[optNAWS] = true
+	c.him[optTType] = true
+	c.mu.Unlock()
+
+	_, err := c.Conn.Write([]byte{
+		cmdIAC, cmdWILL, optEcho,
+		cmdIAC, cmdWILL, optSGA,
+		cmdIAC, cmdDO, optSGA,
+		cmdIAC, cmdDO, optNAWS,
+		cmdIAC, cmdDO, optTType,
+	})
+	return err
+}
+
+func (c *conn) Read(p []byte) (int, error) {
+	if len(p) > len(c.raw) {
+		p = p[:len(c.raw)]
+	}
+	for {
+		n, err := c.Conn.Read(c.raw[:len(p)])
+		out := 0
+		for _, b := range c.raw[:n] {
+			if c.process(b) {
+				p[out] = b
+				out++
+			}
+		}
+		if out > 0 || err != nil {
+			return out, err
+		}
+	}
+}
+
+func (c *conn) Write(p []byte) (int, error) {
+	if bytes.IndexByte(p, cmdIAC) < 0 {
+		return c.Conn.Write(p)
+	}
+	if _, err := c.Conn.Write(bytes.ReplaceAll(p, []byte{cmdIAC}, []byte{cmdIAC, cmdIAC})); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// process feeds one byte through the protocol state machine and reports
+// whether it is user data.
+func (c *conn) process(b byte) bool {
+	switch c.state {
+	case stateData:
+		if b == cmdIAC {
+			c.state = stateIAC
+			return false
+		}
+		if c.cr {
+			c.cr = false
+			if b == 0 || b == '\n' {
+				return false
+			}
+		}
+		c.cr = b == '\r'
+		return true
+	case stateIAC:
+		switch b {
+		case cmdIAC:
+			c.state = stateData
+			return true
+		case cmdWILL, cmdWONT, cmdDO, cmdDONT:
+			c.cmd = b
+			c.state = stateOption
+		case cmdSB:
+			c.sb = c.sb[:0]
+			c.state = stateSB
+		default:
+			// NOP, GA, AYT and friends carry nothing we need
+			c.state = stateData
+		}
+	case stateOption:
+		c.handleOption(c.cmd, b)
+		c.state = stateData
+	case stateSB:
+		if b == cmdIAC {
+			c.state = stateSBIAC
+		} else if len(c.sb) < maxSubnegotiation {
+			c.sb = append(c.sb, b)
+		}
+	case stateSBIAC:
+		switch b {
+		case cmdSE:
+			c.handleSubnegotiation(c.sb)
+			c.state = stateData
+		case cmdIAC:
+			if len(c.sb) < maxSubnegotiation {
+				c.sb = append(c.sb, cmdIAC)
+			}
+			c.state = stateSB
+		default:
+			c.state = stateData
+		}
+	}
+	return false
+}
+
+// handleOption answers WILL/WONT/DO/DONT. Replies are only sent when the
+// option actually changes state, which keeps both sides from looping.
+func (c *conn) handleOption(cmd, opt byte) {
+	c.mu.Lock()
+	var reply []byte
+	echoChanged, localEcho := false, false
+
+	switch cmd {
+	case cmdWILL:
+		switch opt {
+		case optSGA, optNAWS, optTType:
+			if !c.him[opt] {
+				c.him[opt] = true
+				reply = append(reply, cmdIAC, cmdDO, opt)
+			}
+			if opt == optTType {
+				reply = append(reply, cmdIAC, cmdSB, optTType, ttypeSEND, cmdIAC, cmdSE)
+			}
+		default:
+			reply = append(reply, cmdIAC, cmdDONT, opt)
+		}
+	case cmdWONT:
+		if c.him[opt] {
+			c.him[opt] = false
+			reply = append(reply, cmdIAC, cmdDONT, opt)
+		}
+	case cmdDO:
+		switch opt {
+		case optEcho, optSGA:
+			if !c.us[opt] {
+				c.us[opt] = true
+				reply = append(reply, cmdIAC, cmdWILL, opt)
+			}
+			if opt == optEcho {
+				echoChanged, localEcho = true, false
+			}
+		default:
+			reply = append(reply, cmdIAC, cmdWONT, opt)
+		}
+	case cmdDONT:
+		if c.us[opt] {
+			c.us[opt] = false
+			reply = append(reply, cmdIAC, cmdWONT, opt)
+		}
+		if opt == optEcho {
+			echoChanged, localEcho = true, true
+		}
+	}
+	onEcho := c.onEcho
+	c.mu.Unlock()
+
+	if len(reply) > 0 {
+		c.Conn.Write(reply)
+	}
+	if echoChanged && onEcho != nil {
+		onEcho(localEcho)
+	}
+}
+
+func (c *conn) handleSubnegotiation(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch data[0] {
+	case optNAWS:
+		if len(data) == 5 {
+			c.width = int(binary.BigEndian.Uint16(data[1:3]))
+			c.height = int(binary.BigEndian.Uint16(data[3:5]))
+		}
+	case optTType:
+		if len(data) > 1 && data[1] == ttypeIS {
+			c.termType = string(data[2:])
+		}
+	}
+}
+
+func (c *conn) Size() (width, height int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.width, c.height
+}
+
+func (c *conn) TermType() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.termType
+}
@@ -0,0 +1,214 @@
+package telnet
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+)
+
+// fakeConn hands out one chunk per Read and records everything written.
+type fakeConn struct {
+	net.Conn
+	chunks  [][]byte
+	written bytes.Buffer
+}
+
+func (f *fakeConn) Read(p []byte) (int, error) {
+	if len(f.chunks) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, f.chunks[0])
+	f.chunks = f.chunks[1:]
+	return n, nil
+}
+
+func (f *fakeConn) Write(p []byte) (int, error) {
+	return f.written.Write(p)
+}
+
+// readAll feeds chunks through a conn and returns the user data it yields
+// and the replies it sent.
+func readAll(t *testing.T, c *conn, chunks ...[]byte) (data, replies []byte) {
+	t.Helper()
+	fake := c.Conn.(*fakeConn)
+	fake.chunks = chunks
+	p := make([]byte, 1024)
+	for {
+		n, err := c.Read(p)
+		data = append(data, p[:n]...)
+		if err == io.EOF {
+			return data, fake.written.Bytes()
+		}
+		if err != nil {
+			t.Fatalf("Read: %v", err)
+		}
+	}
+}
+
+func TestReadData(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks [][]byte
+		want   string
+	}{
+		{"plain", [][]byte{[]byte("hello")}, "hello"},
+		{"IAC IAC", [][]byte{{'a', cmdIAC, cmdIAC, 'b'}}, "a\xffb"},
+		{"IAC IAC split", [][]byte{{'a', cmdIAC}, {cmdIAC, 'b'}}, "a\xffb"},
+		{"CR NUL", [][]byte{{'a', '\r', 0, 'b'}}, "a\rb"},
+		{"CR LF", [][]byte{[]byte("a\r\nb")}, "a\rb"},
+		{"CR LF split", [][]byte{[]byte("a\r"), []byte("\nb")}, "a\rb"},
+		{"CR CR", [][]byte{[]byte("\r\r\n")}, "\r\r"},
+		{"lone LF", [][]byte{[]byte("a\nb")}, "a\nb"},
+		{"NOP", [][]byte{{'a', cmdIAC, 241, 'b'}}, "ab"},
+		{"SB split", [][]byte{
+			{'a', cmdIAC, cmdSB, optNAWS, 0},
+			{80, 0, 24, cmdIAC},
+			{cmdSE, 'b'},
+		}, "ab"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newConn(&fakeConn{})
+			data, _ := readAll(t, c, tt.chunks...)
+			if string(data) != tt.want {
+				t.Errorf("got %q, want %q", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubnegotiation(t *testing.T) {
+	tests := []struct {
+		name     string
+		chunks   [][]byte
+		width    int
+		height   int
+		termType string
+	}{
+		{"NAWS", [][]byte{{cmdIAC, cmdSB, optNAWS, 0, 80, 0, 24, cmdIAC, cmdSE}}, 80, 24, ""},
+		{"NAWS split", [][]byte{
+			{cmdIAC, cmdSB},
+			{optNAWS, 0, 132},
+			{0, 43, cmdIAC},
+			{cmdSE},
+		}, 132, 43, ""},
+		{"NAWS escaped IAC", [][]byte{{cmdIAC, cmdSB, optNAWS, 0, cmdIAC, cmdIAC, 0, 50, cmdIAC, cmdSE}}, 255, 50, ""},
+		{"NAWS short", [][]byte{{cmdIAC, cmdSB, optNAWS, 0, 80, cmdIAC, cmdSE}}, 0, 0, ""},
+		{"TTYPE", [][]byte{append(append([]byte{cmdIAC, cmdSB, optTType, ttypeIS}, "XTERM"...), cmdIAC, cmdSE)}, 0, 0, "XTERM"},
+		{"TTYPE split", [][]byte{
+			append([]byte{cmdIAC, cmdSB, optTType, ttypeIS}, "VT"...),
+			append([]byte("100"), cmdIAC, cmdSE),
+		}, 0, 0, "VT100"},
+		{"TTYPE SEND ignored", [][]byte{{cmdIAC, cmdSB, optTType, ttypeSEND, cmdIAC, cmdSE}}, 0, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newConn(&fakeConn{})
+			readAll(t, c, tt.chunks...)
+			if w, h := c.Size(); w != tt.width || h != tt.height {
+				t.Errorf("Size() = %d, %d, want %d, %d", w, h, tt.width, tt.height)
+			}
+			if got := c.TermType(); got != tt.termType {
+				t.Errorf("TermType() = %q, want %q", got, tt.termType)
+			}
+		})
+	}
+}
+
+func TestOptionReplies(t *testing.T) {
+	ttypeSend := []byte{cmdIAC, cmdSB, optTType, ttypeSEND, cmdIAC, cmdSE}
+	tests := []struct {
+		name       string
+		negotiated bool
+		input      []byte
+		want       []byte
+	}{
+		{"WILL NAWS", false,
+			[]byte{cmdIAC, cmdWILL, optNAWS},
+			[]byte{cmdIAC, cmdDO, optNAWS}},
+		{"WILL NAWS repeated", false,
+			[]byte{cmdIAC, cmdWILL, optNAWS, cmdIAC, cmdWILL, optNAWS},
+			[]byte{cmdIAC, cmdDO, optNAWS}},
+		{"WILL NAWS after negotiate", true,
+			[]byte{cmdIAC, cmdWILL, optNAWS},
+			nil},
+		{"WILL TTYPE repeated", false,
+			[]byte{cmdIAC, cmdWILL, optTType, cmdIAC, cmdWILL, optTType},
+			append(append([]byte{cmdIAC, cmdDO, optTType}, ttypeSend...), ttypeSend...)},
+		{"WILL unknown", false,
+			[]byte{cmdIAC, cmdWILL, 99},
+			[]byte{cmdIAC, cmdDONT, 99}},
+		{"WONT NAWS after negotiate", true,
+			[]byte{cmdIAC, cmdWONT, optNAWS, cmdIAC, cmdWONT, optNAWS},
+			[]byte{cmdIAC, cmdDONT, optNAWS}},
+		{"WONT never enabled", false,
+			[]byte{cmdIAC, cmdWONT, optNAWS},
+			nil},
+		{"DO ECHO repeated", false,
+			[]byte{cmdIAC, cmdDO, optEcho, cmdIAC, cmdDO, optEcho},
+			[]byte{cmdIAC, cmdWILL, optEcho}},
+		{"DO SGA after negotiate", true,
+			[]byte{cmdIAC, cmdDO, optSGA},
+			nil},
+		{"DO unknown", false,
+			[]byte{cmdIAC, cmdDO, 99},
+			[]byte{cmdIAC, cmdWONT, 99}},
+		{"DONT ECHO repeated", true,
+			[]byte{cmdIAC, cmdDONT, optEcho, cmdIAC, cmdDONT, optEcho},
+			[]byte{cmdIAC, cmdWONT, optEcho}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeConn{}
+			c := newConn(fake)
+			if tt.negotiated {
+				if err := c.negotiate(); err != nil {
+					t.Fatal(err)
+				}
+				fake.written.Reset()
+			}
+			data, replies := readAll(t, c, tt.input)
+			if len(data) > 0 {
+				t.Errorf("got data %q from option negotiation", data)
+			}
+			if !bytes.Equal(replies, tt.want) {
+				t.Errorf("replies = %v, want %v", replies, tt.want)
+			}
+		})
+	}
+}
+
+func TestEchoCallback(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		want  []bool
+	}{
+		{"DO ECHO", []byte{cmdIAC, cmdDO, optEcho}, []bool{false}},
+		{"DONT ECHO", []byte{cmdIAC, cmdDONT, optEcho}, []bool{true}},
+		{"DONT then DO", []byte{cmdIAC, cmdDONT, optEcho, cmdIAC, cmdDO, optEcho}, []bool{true, false}},
+		{"other options", []byte{cmdIAC, cmdDO, optSGA, cmdIAC, cmdDONT, optSGA}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newConn(&fakeConn{})
+			if err := c.negotiate(); err != nil {
+				t.Fatal(err)
+			}
+			var got []bool
+			c.onEcho = func(local bool) {
+				got = append(got, local)
+			}
+			readAll(t, c, tt.input)
+			if len(got) != len(tt.want) {
+				t.Fatalf("onEcho calls = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("onEcho calls = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
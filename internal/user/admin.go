@@ -0,0 +1,154 @@
+package user
+
+import (
+	"database/sql"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Info is what the sysop sees about an account.
+type Info struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+	Banned   bool   `json:"banned"`
+}
+
+// ListUsers returns the accounts whose username contains search, or every
+// account when search is empty.
+func (m *Manager) ListUsers(search string) ([]Info, error) {
+	rows, err := m.db.Query(`
+        SELECT username, role, banned FROM users
+        WHERE username LIKE '%' || ? || '%' ESCAPE '\'
+        ORDER BY username COLLATE NOCASE
+    `, escapeLike(search))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []Info
+	for rows.Next() {
+		var info Info
+		if err := rows.Scan(&info.Username, &info.Role, &info.Banned); err != nil {
+			return nil, err
+		}
+		users = append(users, info)
+	}
+	return users, rows.Err()
+}
+
+// escapeLike makes s match itself literally in a LIKE pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func (m *Manager) Banned(username string) (bool, error) {
+	var banned bool
+	err := m.db.QueryRow("SELECT banned FROM users WHERE username = ?", username).Scan(&banned)
+	if err != nil {
+		return false, err
+	}
+	return banned, nil
+}
+
+// SetBanned bans or unbans an account. Banned users cannot log in by
+// password or SSH key.
+func (m *Manager) SetBanned(username string, banned bool) error {
+	return m.update("UPDATE users SET banned = ? WHERE username = ?", banned, username)
+}
+
+// SetPassword replaces a user's password.
+func (m *Manager) SetPassword(username, password string) error {
+	if err := validatePassword(password); err != nil {
+		return err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	return m.update("UPDATE users SET password = ? WHERE username = ?", string(hashedPassword), username)
+}
+
+// DeleteUser removes an account, its SSH keys, its copy of its mail and its
+// last-read pointers, so that whoever registers the name next starts
+// afresh. Board messages it wrote, and the other party's copy of its mail,
+// are kept.
+func (m *Manager) DeleteUser(username string) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM authorized_keys WHERE user_id = (SELECT id FROM users WHERE username = ?)", username)
+	if err != nil {
+		return err
+	}
+	result, err := tx.Exec("DELETE FROM users WHERE username = ?", username)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	if err := deleteUserData(tx, username); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// deleteUserData clears what the mail and message board packages keep
+// under a username. Their tables live in the same database but may not
+// have been created yet.
+func deleteUserData(tx *sql.Tx, username string) error {
+	hasMail, err := tableExists(tx, "mail")
+	if err != nil {
+		return err
+	}
+	if hasMail {
+		_, err = tx.Exec(`
+            UPDATE mail SET
+                recipient_deleted = CASE WHEN recipient = ? THEN 1 ELSE recipient_deleted END,
+                sender_deleted = CASE WHEN sender = ? THEN 1 ELSE sender_deleted END
+            WHERE recipient = ? OR sender = ?
+        `, username, username, username, username)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("DELETE FROM mail WHERE sender_deleted = 1 AND recipient_deleted = 1 AND (recipient = ? OR sender = ?)", username, username)
+		if err != nil {
+			return err
+		}
+	}
+
+	hasLastRead, err := tableExists(tx, "last_read")
+	if err != nil {
+		return err
+	}
+	if hasLastRead {
+		if _, err := tx.Exec("DELETE FROM last_read WHERE username = ?", username); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func tableExists(tx *sql.Tx, name string) (bool, error) {
+	var n int
+	err := tx.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&n)
+	return n > 0, err
+}
+
+// update runs a statement that changes one user row and reports
+// ErrUserNotFound if none matched.
+func (m *Manager) update(query string, args ...interface{}) error {
+	result, err := m.db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
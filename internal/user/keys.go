@@ -0,0 +1,118 @@
+package user
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	ErrInvalidKey  = errors.New("invalid public key")
+	ErrKeyExists   = errors.New("public key already registered")
+	ErrKeyNotFound = errors.New("public key not found")
+)
+
+type AuthorizedKey struct {
+	Type        string
+	Fingerprint string
+	Comment     string
+	CreatedAt   time.Time
+}
+
+// AddAuthorizedKey registers a public key, given as a line in OpenSSH
+// authorized_keys format, for the user. A key can belong to one account only.
+func (m *Manager) AddAuthorizedKey(username, line string) error {
+	key, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+	if err != nil {
+		return ErrInvalidKey
+	}
+
+	var userID int64
+	err = m.db.QueryRow("SELECT id FROM users WHERE username = ?", username).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrInvalidUsername
+		}
+		return err
+	}
+
+	_, err = m.db.Exec("INSERT INTO authorized_keys (user_id, public_key, fingerprint, comment) VALUES (?, ?, ?, ?)",
+		userID, marshalKey(key), ssh.FingerprintSHA256(key), comment)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "UNIQUE constraint failed") {
+			return ErrKeyExists
+		}
+		return err
+	}
+	return nil
+}
+
+func (m *Manager) RemoveAuthorizedKey(username, fingerprint string) error {
+	result, err := m.db.Exec(`
+        DELETE FROM authorized_keys
+        WHERE fingerprint = ? AND user_id = (SELECT id FROM users WHERE username = ?)
+    `, fingerprint, username)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrKeyNotFound
+	}
+	return nil
+}
+
+func (m *Manager) AuthorizedKeys(username string) ([]AuthorizedKey, error) {
+	rows, err := m.db.Query(`
+        SELECT k.public_key, k.fingerprint, k.comment, k.created_at
+        FROM authorized_keys k JOIN users u ON u.id = k.user_id
+        WHERE u.username = ?
+        ORDER BY k.id
+    `, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []AuthorizedKey
+	for rows.Next() {
+		var publicKey string
+		var key AuthorizedKey
+		if err := rows.Scan(&publicKey, &key.Fingerprint, &key.Comment, &key.CreatedAt); err != nil {
+			return nil, err
+		}
+		key.Type = strings.Fields(publicKey)[0]
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// FindUserByKey returns the username the public key is registered to, or
+// ErrBanned if that account is banned.
+func (m *Manager) FindUserByKey(key ssh.PublicKey) (string, error) {
+	var username string
+	var banned bool
+	err := m.db.QueryRow(`
+        SELECT u.username, u.banned
+        FROM authorized_keys k JOIN users u ON u.id = k.user_id
+        WHERE k.public_key = ?
+    `, marshalKey(key)).Scan(&username, &banned)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", ErrKeyNotFound
+		}
+		return "", err
+	}
+	if banned {
+		return "", ErrBanned
+	}
+	return username, nil
+}
+
+// marshalKey returns the canonical "type base64" form of a key, without the
+// trailing newline or comment ssh.MarshalAuthorizedKey would add.
+func marshalKey(key ssh.PublicKey) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+}
@@ -0,0 +1,73 @@
+package user
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// Roles, from least to most trusted. Each maps to an access level that
+// menus, message boards and the web API compare against their required
+// levels.
+const (
+	RoleGuest     = "guest"
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleSysop     = "sysop"
+)
+
+const (
+	LevelGuest     = 0
+	LevelUser      = 10
+	LevelModerator = 50
+	LevelSysop     = 100
+)
+
+// Roles lists every role in ascending order of access.
+var Roles = []string{RoleGuest, RoleUser, RoleModerator, RoleSysop}
+
+var roleLevels = map[string]int{
+	RoleGuest:     LevelGuest,
+	RoleUser:      LevelUser,
+	RoleModerator: LevelModerator,
+	RoleSysop:     LevelSysop,
+}
+
+var (
+	ErrInvalidRole  = errors.New("invalid role")
+	ErrUserNotFound = errors.New("user not found")
+)
+
+// RoleLevel returns the access level of a role. Unknown roles get guest
+// access.
+func RoleLevel(role string) int {
+	if level, ok := roleLevels[role]; ok {
+		return level
+	}
+	return LevelGuest
+}
+
+func (m *Manager) Role(username string) (string, error) {
+	var role string
+	err := m.db.QueryRow("SELECT role FROM users WHERE username = ?", username).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", ErrUserNotFound
+	}
+	return role, err
+}
+
+// Level returns the access level of the user's role.
+func (m *Manager) Level(username string) (int, error) {
+	role, err := m.Role(username)
+	if err != nil {
+		return LevelGuest, err
+	}
+	return RoleLevel(role), nil
+}
+
+// SetRole promotes or demotes a user.
+func (m *Manager) SetRole(username, role string) error {
+	if _, ok := roleLevels[role]; !ok {
+		return ErrInvalidRole
+	}
+	return m.update("UPDATE users SET role = ? WHERE username = ?", role, username)
+}
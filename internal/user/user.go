@@ -16,6 +16,7 @@ var (
 	ErrInvalidUsername = errors.New("invalid username")
 	ErrInvalidPassword = errors.New("invalid password")
 	ErrUserExists      = errors.New("user already exists")
+	ErrBanned          = errors.New("account is banned")
 )
 
 func NewManager(dbPath string) (*Manager, error) {
@@ -28,7 +29,31 @@ func NewManager(dbPath string) (*Manager, error) {
         CREATE TABLE IF NOT EXISTS users (
             id INTEGER PRIMARY KEY AUTOINCREMENT,
             username TEXT UNIQUE,
-            password TEXT
+            password TEXT,
+            role TEXT NOT NULL DEFAULT 'user',
+            banned INTEGER NOT NULL DEFAULT 0
+        )
+    `)
+	if err != nil {
+		return nil, err
+	}
+
+	// Upgrade users tables created before roles and bans existed
+	if err := addColumn(db, "users", "role", "TEXT NOT NULL DEFAULT 'user'"); err != nil {
+		return nil, err
+	}
+	if err := addColumn(db, "users", "banned", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS authorized_keys (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            user_id INTEGER NOT NULL REFERENCES users(id),
+            public_key TEXT UNIQUE,
+            fingerprint TEXT,
+            comment TEXT,
+            created_at DATETIME DEFAULT CURRENT_TIMESTAMP
         )
     `)
 	if err != nil {
@@ -42,9 +67,12 @@ func (m *Manager) Close() error {
 	return m.db.Close()
 }
 
+// Authenticate checks a username and password. A banned account with the
+// right password gets ErrBanned.
 func (m *Manager) Authenticate(username, password string) (bool, error) {
 	var storedPassword string
-	err := m.db.QueryRow("SELECT password FROM users WHERE username = ?", username).Scan(&storedPassword)
+	var banned bool
+	err := m.db.QueryRow("SELECT password, banned FROM users WHERE username = ?", username).Scan(&storedPassword, &banned)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return false, nil
@@ -52,8 +80,13 @@ func (m *Manager) Authenticate(username, password string) (bool, error) {
 		return false, err
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(storedPassword), []byte(password))
-	return err == nil, nil
+	if bcrypt.CompareHashAndPassword([]byte(storedPassword), []byte(password)) != nil {
+		return false, nil
+	}
+	if banned {
+		return false, ErrBanned
+	}
+	return true, nil
 }
 
 func (m *Manager) CreateUser(username, password string) error {
@@ -80,6 +113,19 @@ func (m *Manager) CreateUser(username, password string) error {
 	return nil
 }
 
+// Exists reports whether an account with the given username exists.
+func (m *Manager) Exists(username string) (bool, error) {
+	var id int64
+	err := m.db.QueryRow("SELECT id FROM users WHERE username = ?", username).Scan(&id)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 func validateUsername(username string) error {
 	if len(username) < 3 || len(username) > 20 {
 		return ErrInvalidUsername
@@ -93,3 +139,31 @@ func validatePassword(password string) error {
 	}
 	return nil
 }
+
+// addColumn adds a column to an existing table unless it is already there.
+func addColumn(db *sql.DB, table, column, definition string) error {
+	rows, err := db.Query("PRAGMA table_info(" + table + ")")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, typ string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition)
+	return err
+}
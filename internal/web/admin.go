@@ -0,0 +1,46 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"gbbs/internal/user"
+)
+
+// roleHandler lets a sysop promote or demote a user with
+// POST {"username": ..., "role": ...}.
+func roleHandler(userManager *user.Manager, sessions *sessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if _, ok := sessions.requireLevel(w, r, user.LevelSysop); !ok {
+			return
+		}
+
+		var req struct {
+			Username string `json:"username"`
+			Role     string `json:"role"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err := userManager.SetRole(req.Username, req.Role)
+		switch err {
+		case nil:
+		case user.ErrUserNotFound:
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case user.ErrInvalidRole:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"username": req.Username, "role": req.Role})
+	}
+}
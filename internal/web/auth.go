@@ -0,0 +1,189 @@
+package web
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"gbbs/internal/node"
+	"gbbs/internal/user"
+)
+
+const (
+	sessionCookie = "gbbs_session"
+	// sessionTTL is how long a session lasts without being used.
+	sessionTTL = 24 * time.Hour
+)
+
+type webSession struct {
+	username string
+	node     *node.Node
+	expires  time.Time
+}
+
+// sessionStore keeps web login sessions in memory, keyed by token. Sessions
+// do not survive a restart. Each one occupies a node, so web users show up
+// in who's online and can be paged.
+type sessionStore struct {
+	users    *user.Manager
+	nodes    *node.Registry
+	mu       sync.Mutex
+	sessions map[string]*webSession
+}
+
+func newSessionStore(users *user.Manager, nodes *node.Registry) *sessionStore {
+	return &sessionStore{users: users, nodes: nodes, sessions: make(map[string]*webSession)}
+}
+
+func (s *sessionStore) create(username, remoteAddr string) (string, time.Time, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", time.Time{}, err
+	}
+	token := hex.EncodeToString(b)
+	expires := time.Now().Add(sessionTTL)
+
+	n := s.nodes.Add("web", remoteAddr, func() { s.remove(token) })
+	n.SetUser(username)
+	n.SetActivity("Web")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune()
+	s.sessions[token] = &webSession{username: username, node: n, expires: expires}
+	return token, expires, nil
+}
+
+// lookup returns the session a token belongs to and extends it.
+func (s *sessionStore) lookup(token string) (*webSession, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[token]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(sess.expires) {
+		s.removeLocked(token)
+		return nil, false
+	}
+	sess.expires = time.Now().Add(sessionTTL)
+	return sess, true
+}
+
+func (s *sessionStore) remove(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removeLocked(token)
+}
+
+func (s *sessionStore) removeLocked(token string) {
+	if sess, ok := s.sessions[token]; ok {
+		s.nodes.Remove(sess.node)
+		delete(s.sessions, token)
+	}
+}
+
+// prune drops expired sessions. The caller must hold s.mu.
+func (s *sessionStore) prune() {
+	now := time.Now()
+	for token, sess := range s.sessions {
+		if now.After(sess.expires) {
+			s.removeLocked(token)
+		}
+	}
+}
+
+// expire prunes sessions periodically so idle web users drop out of who's
+// online.
+func (s *sessionStore) expire(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			s.prune()
+			s.mu.Unlock()
+		}
+	}
+}
+
+// requestToken returns the session token from an "Authorization: Bearer"
+// header or, failing that, the session cookie.
+func requestToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// current returns the session for the request, if it is logged in.
+func (s *sessionStore) current(r *http.Request) (*webSession, bool) {
+	token := requestToken(r)
+	if token == "" {
+		return nil, false
+	}
+	return s.lookup(token)
+}
+
+// currentUser returns the logged-in user for the request, if any.
+func (s *sessionStore) currentUser(r *http.Request) (string, bool) {
+	sess, ok := s.current(r)
+	if !ok {
+		return "", false
+	}
+	return sess.username, true
+}
+
+// access returns the logged-in user and their access level. Anonymous
+// requests get guest access. The account is looked up on every request so
+// role changes, bans and deletions apply to existing sessions.
+func (s *sessionStore) access(r *http.Request) (string, int) {
+	username, ok := s.currentUser(r)
+	if !ok {
+		return "", user.LevelGuest
+	}
+	level, err := s.users.Level(username)
+	if err != nil {
+		return "", user.LevelGuest
+	}
+	if banned, err := s.users.Banned(username); err != nil || banned {
+		return "", user.LevelGuest
+	}
+	return username, level
+}
+
+// requireUser is access for endpoints that need a login; it writes the 401
+// response itself.
+func (s *sessionStore) requireUser(w http.ResponseWriter, r *http.Request) (string, int, bool) {
+	username, level := s.access(r)
+	if username == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="gbbs"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return "", 0, false
+	}
+	return username, level, true
+}
+
+// requireLevel is requireUser for endpoints restricted to a minimum access
+// level.
+func (s *sessionStore) requireLevel(w http.ResponseWriter, r *http.Request, min int) (string, bool) {
+	username, level, ok := s.requireUser(w, r)
+	if !ok {
+		return "", false
+	}
+	if level < min {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return "", false
+	}
+	return username, true
+}
@@ -0,0 +1,102 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gbbs/internal/chat"
+	"gbbs/internal/node"
+	"gbbs/internal/user"
+)
+
+// pagesHandler delivers pages to web users, who have no open connection:
+// GET returns and clears the pages waiting for the logged-in user, and
+// POST {"to": ..., "text": ...} pages another user.
+func pagesHandler(nodes *node.Registry, sessions *sessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sess, ok := sessions.current(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="gbbs"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			json.NewEncoder(w).Encode(sess.node.Pending())
+		case http.MethodPost:
+			_, level := sessions.access(r)
+			if level < user.LevelUser {
+				http.Error(w, "Guests cannot page other users", http.StatusForbidden)
+				return
+			}
+			var req struct {
+				To   string `json:"to"`
+				Text string `json:"text"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			req.Text = strings.TrimSpace(req.Text)
+			if req.Text == "" {
+				http.Error(w, "Page cannot be empty", http.StatusBadRequest)
+				return
+			}
+			msg := node.Message{Kind: node.KindPage, From: sess.username, Text: req.Text}
+			if nodes.Page(req.To, msg) == 0 {
+				http.Error(w, req.To+" is not online", http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"message": "Page sent"})
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// chatHandler lets web users follow the teleconference with
+// GET /api/chat?since=ID and talk in it with POST {"text": ...}.
+func chatHandler(room *chat.Room, sessions *sessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			var since int64
+			if s := r.URL.Query().Get("since"); s != "" {
+				var err error
+				since, err = strconv.ParseInt(s, 10, 64)
+				if err != nil {
+					http.Error(w, "Invalid since", http.StatusBadRequest)
+					return
+				}
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"members": room.Members(),
+				"lines":   room.History(since),
+			})
+		case http.MethodPost:
+			username, _, ok := sessions.requireUser(w, r)
+			if !ok {
+				return
+			}
+			var req struct {
+				Text string `json:"text"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			req.Text = strings.TrimSpace(req.Text)
+			if req.Text == "" {
+				http.Error(w, "Message cannot be empty", http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(room.Say(nil, username, req.Text))
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"gbbs/internal/mail"
+	"gbbs/internal/user"
+)
+
+// mailHandler serves the authenticated user's mailbox:
+//
+//	GET    /api/mail?folder=inbox|sent  list a folder
+//	GET    /api/mail?id=N               read one mail, marking it read
+//	POST   /api/mail                    send {to, subject, body}
+//	DELETE /api/mail?id=N               delete from the user's folders
+func mailHandler(sessions *sessionStore, mailManager *mail.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, level, ok := sessions.requireUser(w, r)
+		if !ok {
+			return
+		}
+
+		var id int64
+		if s := r.URL.Query().Get("id"); s != "" {
+			var err error
+			id, err = strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid mail id", http.StatusBadRequest)
+				return
+			}
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			if id != 0 {
+				m, err := mailManager.Get(username, id)
+				if err == mail.ErrMailNotFound {
+					http.Error(w, err.Error(), http.StatusNotFound)
+					return
+				}
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				if m.To == username && m.Read == nil {
+					if err := mailManager.MarkRead(username, id); err != nil {
+						http.Error(w, err.Error(), http.StatusInternalServerError)
+						return
+					}
+				}
+				json.NewEncoder(w).Encode(m)
+				return
+			}
+
+			var mails []mail.Mail
+			var err error
+			switch r.URL.Query().Get("folder") {
+			case "", "inbox":
+				mails, err = mailManager.Inbox(username)
+			case "sent":
+				mails, err = mailManager.Sent(username)
+			default:
+				http.Error(w, "Unknown folder", http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			unread, err := mailManager.UnreadCount(username)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"unread": unread, "mail": mails})
+		case http.MethodPost:
+			if level < user.LevelUser {
+				http.Error(w, "Guests cannot send mail", http.StatusForbidden)
+				return
+			}
+			var req struct {
+				To      string `json:"to"`
+				Subject string `json:"subject"`
+				Body    string `json:"body"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			sent, err := mailManager.Send(username, req.To, req.Subject, req.Body)
+			if err == mail.ErrNoSuchUser {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(sent)
+		case http.MethodDelete:
+			if id == 0 {
+				http.Error(w, "Missing mail id", http.StatusBadRequest)
+				return
+			}
+			err := mailManager.Delete(username, id)
+			if err == mail.ErrMailNotFound {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"message": "Mail deleted"})
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
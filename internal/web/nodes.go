@@ -0,0 +1,45 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"gbbs/internal/node"
+	"gbbs/internal/user"
+)
+
+// nodesHandler lists who is online with GET, and lets a sysop drop a
+// connection with DELETE /api/nodes?node=N. Only sysops see remote
+// addresses.
+func nodesHandler(nodes *node.Registry, sessions *sessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			_, level := sessions.access(r)
+			list := nodes.List()
+			if level < user.LevelSysop {
+				for i := range list {
+					list[i].RemoteAddr = ""
+				}
+			}
+			json.NewEncoder(w).Encode(list)
+		case http.MethodDelete:
+			if _, ok := sessions.requireLevel(w, r, user.LevelSysop); !ok {
+				return
+			}
+			number, err := strconv.Atoi(r.URL.Query().Get("node"))
+			if err != nil {
+				http.Error(w, "Invalid node number", http.StatusBadRequest)
+				return
+			}
+			if err := nodes.Disconnect(number); err == node.ErrNoSuchNode {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"message": "Node disconnected"})
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -1,24 +1,61 @@
 package web
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"gbbs/internal/messageboard"
+	"gbbs/internal/session"
 	"gbbs/internal/user"
 	"net/http"
+	"strconv"
+	"time"
 )
 
-func Serve(port int, webRoot string, userManager *user.Manager, messageBoard *messageboard.MessageBoard) error {
-	http.Handle("/", http.FileServer(http.Dir(webRoot)))
-	http.HandleFunc("/api/login", loginHandler(userManager))
-	http.HandleFunc("/api/register", registerHandler(userManager))
-	http.HandleFunc("/api/messages", messagesHandler(messageBoard))
+// Serve runs the web interface until ctx is cancelled, then lets requests in
+// flight finish.
+func Serve(ctx context.Context, svc *session.Services) error {
+	userManager, boards := svc.Users, svc.Boards
+	sessions := newSessionStore(userManager, svc.Nodes)
+	go sessions.expire(ctx, time.Minute)
 
-	return http.ListenAndServe(fmt.Sprintf(":%d", port), nil)
+	mux := http.NewServeMux()
+
+	mux.Handle("/", http.FileServer(http.Dir(svc.Config.WebRoot)))
+	mux.HandleFunc("/api/login", loginHandler(userManager, sessions))
+	mux.HandleFunc("/api/logout", logoutHandler(sessions))
+	mux.HandleFunc("/api/register", registerHandler(userManager))
+	mux.HandleFunc("/api/boards", boardsHandler(boards, sessions))
+	mux.HandleFunc("/api/read", markReadHandler(boards, sessions))
+	mux.HandleFunc("/api/threads", threadsHandler(boards, sessions))
+	mux.HandleFunc("/api/messages", messagesHandler(boards, sessions))
+	mux.HandleFunc("/api/mail", mailHandler(sessions, svc.Mail))
+	mux.HandleFunc("/api/nodes", nodesHandler(svc.Nodes, sessions))
+	mux.HandleFunc("/api/pages", pagesHandler(svc.Nodes, sessions))
+	mux.HandleFunc("/api/chat", chatHandler(svc.Chat, sessions))
+	mux.HandleFunc("/api/admin/role", roleHandler(userManager, sessions))
+
+	srv := &http.Server{Addr: fmt.Sprintf(":%d", svc.Config.WebPort), Handler: mux}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
 }
 
-func loginHandler(userManager *user.Manager) http.HandlerFunc {
+func loginHandler(userManager *user.Manager, sessions *sessionStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
 		var creds struct {
 			Username string `json:"username"`
 			Password string `json:"password"`
@@ -30,6 +67,10 @@ func loginHandler(userManager *user.Manager) http.HandlerFunc {
 		}
 
 		authenticated, err := userManager.Authenticate(creds.Username, creds.Password)
+		if err == user.ErrBanned {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -40,8 +81,52 @@ func loginHandler(userManager *user.Manager) http.HandlerFunc {
 			return
 		}
 
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Login successful"})
+		role, err := userManager.Role(creds.Username)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		token, expires, err := sessions.create(creds.Username, r.RemoteAddr)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessionCookie,
+			Value:    token,
+			Path:     "/",
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+			Secure:   r.TLS != nil,
+		})
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Login successful",
+			"token":   token,
+			"expires": expires,
+			"role":    role,
+		})
+	}
+}
+
+func logoutHandler(sessions *sessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if token := requestToken(r); token != "" {
+			sessions.remove(token)
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessionCookie,
+			Value:    "",
+			Path:     "/",
+			MaxAge:   -1,
+			HttpOnly: true,
+		})
+		json.NewEncoder(w).Encode(map[string]string{"message": "Logged out"})
 	}
 }
 
@@ -67,31 +152,179 @@ func registerHandler(userManager *user.Manager) http.HandlerFunc {
 	}
 }
 
-func messagesHandler(messageBoard *messageboard.MessageBoard) http.HandlerFunc {
+type boardInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	CanPost     bool   `json:"can_post"`
+	Unread      int    `json:"unread"`
+}
+
+func boardsHandler(boards *messageboard.Manager, sessions *sessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Unread counts are only known for a logged-in user
+		username, level := sessions.access(r)
+		unread := map[string]int{}
+		if username != "" {
+			var err error
+			unread, err = boards.UnreadCounts(username, level)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		var list []boardInfo
+		for _, b := range boards.List(level) {
+			list = append(list, boardInfo{
+				Name:        b.Name,
+				Description: b.Description,
+				CanPost:     b.CanPost(level),
+				Unread:      unread[b.Name],
+			})
+		}
+		json.NewEncoder(w).Encode(list)
+	}
+}
+
+func markReadHandler(boards *messageboard.Manager, sessions *sessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		username, level, ok := sessions.requireUser(w, r)
+		if !ok {
+			return
+		}
+
+		var req struct {
+			Board     string `json:"board"`
+			MessageID int64  `json:"message_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		board := lookupBoard(boards, req.Board, level)
+		if board == nil {
+			http.Error(w, "Board not found", http.StatusNotFound)
+			return
+		}
+		if err := board.MarkRead(username, req.MessageID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"message": "Marked as read"})
+	}
+}
+
+// lookupBoard returns the named board, or the default one when name is
+// empty, if the given access level may read it.
+func lookupBoard(boards *messageboard.Manager, name string, level int) *messageboard.Board {
+	if name == "" {
+		return boards.Default(level)
+	}
+	board := boards.Get(name)
+	if board == nil || !board.CanRead(level) {
+		return nil
+	}
+	return board
+}
+
+func threadsHandler(boards *messageboard.Manager, sessions *sessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		_, level := sessions.access(r)
+		board := lookupBoard(boards, r.URL.Query().Get("board"), level)
+		if board == nil {
+			http.Error(w, "Board not found", http.StatusNotFound)
+			return
+		}
+		threads, err := board.Threads()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(threads)
+	}
+}
+
+func messagesHandler(boards *messageboard.Manager, sessions *sessionStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
-			messages, err := messageBoard.GetMessages()
+			_, level := sessions.access(r)
+			board := lookupBoard(boards, r.URL.Query().Get("board"), level)
+			if board == nil {
+				http.Error(w, "Board not found", http.StatusNotFound)
+				return
+			}
+			if thread := r.URL.Query().Get("thread"); thread != "" {
+				id, err := strconv.ParseInt(thread, 10, 64)
+				if err != nil {
+					http.Error(w, "Invalid thread id", http.StatusBadRequest)
+					return
+				}
+				entries, err := board.Thread(id)
+				if err == messageboard.ErrMessageNotFound {
+					http.Error(w, err.Error(), http.StatusNotFound)
+					return
+				}
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				json.NewEncoder(w).Encode(entries)
+				return
+			}
+			messages, err := board.GetMessages()
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
 			json.NewEncoder(w).Encode(messages)
 		case http.MethodPost:
+			// The author is always the logged-in user, never the request body
+			username, level, ok := sessions.requireUser(w, r)
+			if !ok {
+				return
+			}
+
 			var msg struct {
-				Username string `json:"username"`
+				Subject  string `json:"subject"`
 				Message  string `json:"message"`
+				ParentID int64  `json:"parent_id"`
+				Board    string `json:"board"`
 			}
 			if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
 				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
 			}
-			if err := messageBoard.PostMessage(msg.Username, msg.Message); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+			board := lookupBoard(boards, msg.Board, level)
+			if board == nil {
+				http.Error(w, "Board not found", http.StatusNotFound)
+				return
+			}
+			if !board.CanPost(level) {
+				http.Error(w, "Posting not allowed on this board", http.StatusForbidden)
+				return
+			}
+			posted, err := board.PostMessage(username, msg.Subject, msg.Message, msg.ParentID)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
 			}
 			w.WriteHeader(http.StatusCreated)
-			json.NewEncoder(w).Encode(map[string]string{"message": "Message posted successfully"})
+			json.NewEncoder(w).Encode(posted)
 		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}